@@ -2,18 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
+	"time"
 
 	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/kubernetes"
+	"github.com/wbh1/latr/internal/leader"
 	"github.com/wbh1/latr/internal/linode"
 	"github.com/wbh1/latr/internal/observability"
 	"github.com/wbh1/latr/internal/rotation"
 	"github.com/wbh1/latr/internal/scheduler"
+	"github.com/wbh1/latr/internal/storage"
 	"github.com/wbh1/latr/internal/vault"
 )
 
@@ -46,13 +53,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Load Linode API token from environment
-	linodeToken := os.Getenv("LINODE_TOKEN")
-	if linodeToken == "" {
-		logger.Error("Missing required environment variable", slog.String("variable", "LINODE_TOKEN"))
-		os.Exit(1)
-	}
-
 	// Load and validate configuration
 	logger.Info("Loading configuration", slog.String("path", *configPath))
 	cfg, err := config.LoadAndValidate(*configPath)
@@ -86,16 +86,26 @@ func main() {
 	logger = observability.GetLogger()
 	defer telemetryCleanup()
 
-	// Create Linode client
-	linodeClient := linode.NewClient(linodeToken)
-	logger.InfoContext(ctx, "Linode client initialized")
-
 	// Create Vault client
 	vaultConfig := &vault.Config{
 		Address:   cfg.Vault.Address,
 		RoleID:    cfg.Vault.RoleID,
 		SecretID:  cfg.Vault.SecretID,
 		MountPath: cfg.Vault.MountPath,
+		Namespace: cfg.Vault.Namespace,
+		KVVersion: cfg.Vault.KVVersion,
+
+		AuthMethod:     cfg.Vault.Auth.Method,
+		AuthMountPath:  cfg.Vault.Auth.MountPath,
+		KubernetesRole: cfg.Vault.Auth.Role,
+		JWTPath:        cfg.Vault.Auth.JWTPath,
+
+		CACert:             cfg.Vault.CACert,
+		CAPath:             cfg.Vault.CAPath,
+		ClientCert:         cfg.Vault.ClientCert,
+		ClientKey:          cfg.Vault.ClientKey,
+		TLSServerName:      cfg.Vault.TLSServerName,
+		InsecureSkipVerify: cfg.Vault.InsecureSkipVerify,
 	}
 
 	vaultClient, err := vault.NewClient(vaultConfig)
@@ -106,15 +116,114 @@ func main() {
 		os.Exit(1)
 	}
 	logger.InfoContext(ctx, "Vault client initialized and authenticated",
-		slog.String("vault_address", cfg.Vault.Address))
+		slog.String("vault_address", cfg.Vault.Address),
+		slog.String("auth_method", cfg.Vault.Auth.Method))
+
+	logVaultPaths(ctx, logger, cfg, vaultClient)
+
+	// Long-running daemons must outlive the Vault token's TTL
+	if cfg.Daemon.Mode == "daemon" {
+		vaultClient.StartRenewal(ctx)
+	}
+
+	// Create Kubernetes client only when a token is stored in a Secret or a Lease is used
+	election := cfg.Daemon.LeaderElection
+	var kubeClient *kubernetes.Client
+	if cfg.UsesStorageType(config.StorageTypeKubernetes) ||
+		(election.Enabled && election.Backend == config.LeaderElectionKubernetes) ||
+		cfg.Rotation.Lock.Backend == config.LeaderElectionKubernetes {
+		client, err := kubernetes.NewClient(&kubernetes.Config{
+			Kubeconfig: cfg.Kubernetes.Kubeconfig,
+			Context:    cfg.Kubernetes.Context,
+		})
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to create Kubernetes client", slog.Any("error", err))
+			os.Exit(1)
+		}
+		kubeClient = client
+		logger.InfoContext(ctx, "Kubernetes client initialized")
+	}
 
 	// Create rotation engine
-	engine := rotation.NewEngine(linodeClient, vaultClient, cfg.Daemon.DryRun)
+	var storageKubeClient storage.KubernetesClient
+	if kubeClient != nil {
+		storageKubeClient = kubeClient
+	}
+	storages := storage.NewDefaultRegistry(vaultClient, storageKubeClient)
+
+	// Storage types registered beyond the built-in ones are checked against the registry that creates them
+	if err := cfg.ValidateStorage(storages); err != nil {
+		logger.ErrorContext(ctx, "Invalid storage configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// Create a Linode client for each account with tokens, whose token is read again before each cycle
+	// The backoffs are checked when the config is validated
+	initialBackoff, _ := time.ParseDuration(cfg.Linode.Retry.InitialBackoff)
+	maxBackoff, _ := time.ParseDuration(cfg.Linode.Retry.MaxBackoff)
+	retryPolicy := linode.RetryPolicy{
+		MaxAttempts:    cfg.Linode.Retry.MaxAttempts,
+		InitialBackoff: initialBackoff,
+		MaxBackoff:     maxBackoff,
+	}
+	linodeClients := make(accountClients)
+	for _, account := range cfg.TokenAccounts() {
+		client, err := newAccountClient(ctx, logger, cfg, account, vaultClient, storages)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to set up the Linode client",
+				slog.String("account", account),
+				slog.Any("error", err))
+			os.Exit(1)
+		}
+		client.SetRetryPolicy(retryPolicy)
+		linodeClients[account] = client
+		logger.InfoContext(ctx, "Linode client initialized", slog.String("account", account))
+	}
+
+	engine := rotation.NewEngine(nil, vaultClient, storages, cfg.Daemon.DryRun)
+	for account, client := range linodeClients {
+		engine.SetAccountClient(account, client)
+		if selfToken := cfg.SelfToken(account); selfToken != nil {
+			engine.SetSelfToken(account, selfToken.Label)
+		}
+	}
+
+	if cfg.Rotation.Lock.Backend == config.LeaderElectionVault {
+		if err := checkVaultTokenLocks(ctx, cfg, vaultClient); err != nil {
+			logger.ErrorContext(ctx, "Invalid token lock configuration", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
+	if cfg.Rotation.Lock.Backend != config.TokenLockNone {
+		tokenLocks, err := newTokenLocks(cfg.Rotation.Lock, vaultClient, kubeClient)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to set up token locks", slog.Any("error", err))
+			os.Exit(1)
+		}
+		engine.SetTokenLocks(tokenLocks)
+	}
+
+	if cfg.Rotation.Verify.Enabled {
+		// The timeout is checked when the config is validated
+		timeout, _ := time.ParseDuration(cfg.Rotation.Verify.Timeout)
+		engine.SetVerification(&rotation.Verification{Timeout: timeout})
+	}
 
 	// Create scheduler
 	sched := scheduler.NewScheduler(cfg, engine)
+	sched.SetTokenRefresher(linodeClients)
 	defer cancel()
 
+	if election.Enabled {
+		leaderElection, err := newLeaderElection(election, vaultClient, kubeClient)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to set up leader election", slog.Any("error", err))
+			os.Exit(1)
+		}
+		sched.SetLeaderElection(leaderElection)
+	}
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
@@ -141,3 +250,206 @@ func main() {
 
 	logger.Info("latr finished successfully")
 }
+
+// newTokenLocks creates the engine's per-token locks from their configuration
+// Overlapping runs may share a host, so the identity includes the process ID.
+func newTokenLocks(cfg config.TokenLockConfig, vaultClient *vault.Client, kubeClient *kubernetes.Client) (*rotation.TokenLocks, error) {
+	var leaderKubeClient leader.KubernetesClient
+	if kubeClient != nil {
+		leaderKubeClient = kubeClient
+	}
+
+	locker, err := leader.NewLocker(cfg, vaultClient, leaderKubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine identity: %w", err)
+	}
+
+	// The duration is checked when the config is validated
+	leaseDuration, _ := time.ParseDuration(cfg.LeaseDuration)
+
+	return &rotation.TokenLocks{
+		Locker:        locker,
+		Identity:      fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		LeaseDuration: leaseDuration,
+	}, nil
+}
+
+// checkVaultTokenLocks makes sure every token's lock can be held by its Vault mount
+// Locks sit next to the token state, on the mount of the token's first storage path
+// (which validation requires to be a vault entry), and need KV v2. Tokens are never processed without their lock, so a KV v1 mount
+// has to be caught before the first rotation.
+func checkVaultTokenLocks(ctx context.Context, cfg *config.Config, vaultClient *vault.Client) error {
+	var errs []error
+	for _, token := range cfg.Tokens {
+		s := token.Storage[0]
+		storageCtx := vault.WithMount(vault.WithNamespace(ctx, s.VaultNamespace()), s.VaultMount())
+		version, err := vaultClient.KVVersion(storageCtx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("token %s: %w", token.Label, err))
+			continue
+		}
+		if version == 1 {
+			errs = append(errs, fmt.Errorf("token %s: the vault lock backend requires a KV v2 mount, set rotation.lock.backend to none, kubernetes or file", token.Label))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newLeaderElection creates the scheduler's leader election from its configuration
+// The identity defaults to the hostname, which is the pod name in Kubernetes.
+func newLeaderElection(cfg config.LeaderElectionConfig, vaultClient *vault.Client, kubeClient *kubernetes.Client) (*scheduler.LeaderElection, error) {
+	var leaderKubeClient leader.KubernetesClient
+	if kubeClient != nil {
+		leaderKubeClient = kubeClient
+	}
+
+	lock, err := leader.New(cfg, vaultClient, leaderKubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := cfg.Identity
+	if identity == "" {
+		identity, err = os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine identity: %w", err)
+		}
+	}
+
+	// Durations are checked when the config is validated
+	leaseDuration, _ := time.ParseDuration(cfg.LeaseDuration)
+	renewInterval, _ := time.ParseDuration(cfg.RenewInterval)
+
+	return &scheduler.LeaderElection{
+		Lock:          lock,
+		Identity:      identity,
+		LeaseDuration: leaseDuration,
+		RenewInterval: renewInterval,
+	}, nil
+}
+
+// accountClients holds the Linode client of each account, by name
+type accountClients map[string]*linode.Client
+
+// RefreshToken reads the token of each account's client again
+// An account whose token can't be read keeps its current one.
+func (c accountClients) RefreshToken(ctx context.Context) error {
+	var errs []error
+	for _, account := range slices.Sorted(maps.Keys(c)) {
+		if err := c[account].RefreshToken(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", account, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newAccountClient creates the Linode client of the named account and loads its token
+func newAccountClient(ctx context.Context, logger *slog.Logger, cfg *config.Config, account string, vaultClient *vault.Client, storages *storage.Registry) (*linode.Client, error) {
+	tokenSource, err := newLinodeTokenSource(logger, cfg, account, vaultClient, storages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the Linode token source: %w", err)
+	}
+
+	client := linode.NewClient("")
+	if accountConfig, _ := cfg.Account(account); accountConfig.APIURL != "" {
+		client.SetBaseURL(accountConfig.APIURL)
+	}
+	client.SetTokenSource(tokenSource)
+	if err := client.RefreshToken(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load the Linode token: %w", err)
+	}
+
+	return client, nil
+}
+
+// newLinodeTokenSource returns where the named account's Linode API token is read from
+// When latr manages its own token, it's read from the token's first storage path, and
+// the configured source is only used until the token has been stored for the first time.
+func newLinodeTokenSource(logger *slog.Logger, cfg *config.Config, account string, vaultClient *vault.Client, storages *storage.Registry) (linode.TokenSource, error) {
+	// Accounts are checked when the config is validated
+	accountConfig, _ := cfg.Account(account)
+
+	var configured linode.TokenSource
+	switch {
+	case accountConfig.TokenFile != "":
+		configured = linode.FileTokenSource(accountConfig.TokenFile)
+	case accountConfig.TokenVaultPath != "":
+		path := accountConfig.TokenVaultPath
+		configured = func(ctx context.Context) (string, error) {
+			return vaultClient.ReadToken(ctx, path)
+		}
+	default:
+		configured = linode.EnvTokenSource(accountConfig.TokenEnv)
+	}
+
+	selfToken := cfg.SelfToken(account)
+	if selfToken == nil {
+		return configured, nil
+	}
+
+	backend, err := storages.New(selfToken.Storage[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// The configured token only bootstraps latr until its own token has been stored. Once
+	// it has, a failed read is returned so the client keeps the token it already has,
+	// rather than switching back to a token that may have been revoked.
+	return func(ctx context.Context) (string, error) {
+		token, err := backend.Read(ctx)
+		if err == nil {
+			return token, nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return "", fmt.Errorf("failed to read latr's own token from %s: %w", backend.Describe(), err)
+		}
+
+		bootstrapToken, bootstrapErr := configured(ctx)
+		if bootstrapErr != nil {
+			return "", fmt.Errorf("latr's own token isn't stored in %s yet, and the configured token can't be read: %w", backend.Describe(), bootstrapErr)
+		}
+		logger.WarnContext(ctx, "latr's own Linode token isn't stored yet, using the configured token until it is created",
+			slog.String("account", account),
+			slog.String("token_label", selfToken.Label),
+			slog.String("path", backend.Describe()),
+			slog.Any("error", err))
+		return bootstrapToken, nil
+	}, nil
+}
+
+// logVaultPaths logs the KV API path each token is written to, so that
+// misconfigured paths are spotted before the first rotation
+func logVaultPaths(ctx context.Context, logger *slog.Logger, cfg *config.Config, vaultClient *vault.Client) {
+	for _, token := range cfg.Tokens {
+		for _, s := range token.Storage {
+			if s.Type != config.StorageTypeVault {
+				continue
+			}
+
+			storageCtx := vault.WithMount(vault.WithNamespace(ctx, s.VaultNamespace()), s.VaultMount())
+			apiPath, err := vaultClient.ResolvePath(storageCtx, s.Path)
+			if err != nil {
+				logger.WarnContext(ctx, "Failed to resolve Vault path",
+					slog.String("token_label", token.Label),
+					slog.String("path", s.Path),
+					slog.Any("error", err))
+				continue
+			}
+
+			namespace := s.VaultNamespace()
+			if namespace == "" {
+				namespace = cfg.Vault.Namespace
+			}
+			logger.InfoContext(ctx, "Resolved Vault path",
+				slog.String("token_label", token.Label),
+				slog.String("storage_type", s.Type),
+				slog.String("namespace", namespace),
+				slog.String("path", apiPath))
+		}
+	}
+}
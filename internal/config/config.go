@@ -1,42 +1,181 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/wbh1/latr/internal/linode"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the complete configuration for the token rotator
 type Config struct {
-	Daemon        DaemonConfig        `yaml:"daemon"`
-	Rotation      RotationConfig      `yaml:"rotation"`
-	Vault         VaultConfig         `yaml:"vault"`
-	Observability ObservabilityConfig `yaml:"observability"`
-	Tokens        []TokenConfig       `yaml:"tokens"`
+	Daemon        DaemonConfig             `yaml:"daemon"`
+	Rotation      RotationConfig           `yaml:"rotation"`
+	Linode        LinodeConfig             `yaml:"linode"`
+	Accounts      map[string]AccountConfig `yaml:"accounts"` // Further Linode accounts, by name
+	Vault         VaultConfig              `yaml:"vault"`
+	Kubernetes    KubernetesConfig         `yaml:"kubernetes"`
+	Observability ObservabilityConfig      `yaml:"observability"`
+	Tokens        []TokenConfig            `yaml:"tokens"`
 }
 
 // DaemonConfig contains settings for daemon behavior
 type DaemonConfig struct {
-	Mode          string `yaml:"mode"`
-	CheckInterval string `yaml:"check_interval"`
-	DryRun        bool   `yaml:"dry_run"`
+	Mode           string               `yaml:"mode"`
+	CheckInterval  string               `yaml:"check_interval"`
+	DryRun         bool                 `yaml:"dry_run"`
+	LeaderElection LeaderElectionConfig `yaml:"leader_election"`
+}
+
+// Supported leader election backends
+const (
+	LeaderElectionVault      = "vault"
+	LeaderElectionKubernetes = "kubernetes"
+	LeaderElectionFile       = "file"
+)
+
+// LeaderElectionConfig lets several replicas run while only one rotates tokens
+type LeaderElectionConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Backend       string `yaml:"backend"`        // vault (default), kubernetes, or file
+	Path          string `yaml:"path"`           // Vault KV path, Lease name, or lock file path
+	Namespace     string `yaml:"namespace"`      // Namespace of the Lease, defaults to the pod's namespace
+	Identity      string `yaml:"identity"`       // Lock holder identity, defaults to the hostname
+	LeaseDuration string `yaml:"lease_duration"` // How long the lock is held without being renewed
+	RenewInterval string `yaml:"renew_interval"` // How often the leader renews and standbys retry
 }
 
 // RotationConfig contains settings for token rotation
 type RotationConfig struct {
-	ThresholdPercent int `yaml:"threshold_percent"`
+	ThresholdPercent int             `yaml:"threshold_percent"`
+	OnStorageFailure string          `yaml:"on_storage_failure"` // Default policy for tokens that don't set one
+	OnNonExpiring    string          `yaml:"on_non_expiring"`    // Default policy for tokens that don't set one
+	Lock             TokenLockConfig `yaml:"lock"`
+	Verify           VerifyConfig    `yaml:"verify"`
+}
+
+// VerifyConfig configures the checks made on a new token before a rotation counts as successful
+// The token has to be accepted by the Linode API for each of its scopes, and every storage
+// backend has to return it when read back.
+type VerifyConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Timeout string `yaml:"timeout"` // How long to wait for Linode to accept a new token
+}
+
+// Policies for a new token that couldn't be delivered to every storage backend
+const (
+	StorageFailureKeep     = "keep"     // Keep the token and redeliver it on the next run
+	StorageFailureRollback = "rollback" // Revoke the token and restore the backends
+)
+
+// Policies for a token with a managed label that never expires, e.g. one created by hand
+const (
+	NonExpiringAdoptAndRotate = "adopt_and_rotate" // Replace it with an expiring token
+	NonExpiringIgnore         = "ignore"           // Leave it alone
+	NonExpiringFail           = "fail"             // Fail processing the token
+)
+
+// DefaultAccount is the name of the Linode account configured under linode, which
+// tokens that don't name an account belong to
+const DefaultAccount = "default"
+
+// validAccountName matches account names, which end up in lock names and metric attributes
+var validAccountName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// LinodeConfig contains settings for the Linode API client
+// The retry settings apply to every account, the rest configures the default account.
+type LinodeConfig struct {
+	Retry         LinodeRetryConfig `yaml:"retry"`
+	AccountConfig `yaml:",inline"`
+}
+
+// AccountConfig contains the credentials and API of a Linode account
+type AccountConfig struct {
+	// Where the API token is read from, again before each rotation cycle. Only one may be
+	// set. The default account uses the LINODE_TOKEN environment variable if none is.
+	TokenFile      string `yaml:"token_file"`       // File holding the token, e.g. a mounted secret
+	TokenVaultPath string `yaml:"token_vault_path"` // Vault KV path whose token field holds the token
+	TokenEnv       string `yaml:"token_env"`        // Environment variable holding the token
+
+	// APIURL is the base URL of the account's API, without the version
+	// It defaults to the public API.
+	APIURL string `yaml:"api_url"`
+
+	// SelfToken is the label of the account's configured token that latr itself uses
+	// Its value is read from the token's first storage path, which is always in Vault,
+	// and the client switches to each new token once it has been delivered.
+	SelfToken string `yaml:"self_token"`
+}
+
+// LinodeRetryConfig configures retries of Linode API requests that failed with a
+// rate limit (429), a server error (5xx) or a network error
+type LinodeRetryConfig struct {
+	MaxAttempts    int    `yaml:"max_attempts"`    // Attempts per request, including the first
+	InitialBackoff string `yaml:"initial_backoff"` // Wait before the first retry, doubled for each retry after it
+	MaxBackoff     string `yaml:"max_backoff"`     // Longest wait between attempts, including one asked for by Retry-After
+}
+
+// Supported token lock backends, in addition to the leader election backends
+const (
+	TokenLockNone = "none"
+)
+
+// TokenLockConfig configures the per-token locks taken around rotation
+// Vault locks are kept next to the token state, so Path only applies to the other backends.
+type TokenLockConfig struct {
+	Backend       string `yaml:"backend"`        // vault (default), kubernetes, file, or none
+	Path          string `yaml:"path"`           // Lease name prefix, or directory of lock files
+	Namespace     string `yaml:"namespace"`      // Namespace of the Leases, defaults to the pod's namespace
+	LeaseDuration string `yaml:"lease_duration"` // How long a lock is held without being renewed
 }
 
 // VaultConfig contains Vault connection and authentication settings
 type VaultConfig struct {
-	Address   string `yaml:"address"`
-	RoleID    string `yaml:"role_id"`
-	SecretID  string `yaml:"secret_id"`
-	MountPath string `yaml:"mount_path"`
+	Address   string          `yaml:"address"`
+	RoleID    string          `yaml:"role_id"`
+	SecretID  string          `yaml:"secret_id"`
+	MountPath string          `yaml:"mount_path"`
+	Namespace string          `yaml:"namespace"`  // Vault Enterprise namespace, also used for login
+	KVVersion int             `yaml:"kv_version"` // KV engine version (1 or 2), detected when unset
+	Auth      VaultAuthConfig `yaml:"auth"`
+
+	// TLS settings, paths are PEM files
+	CACert             string `yaml:"ca_cert"`
+	CAPath             string `yaml:"ca_path"`
+	ClientCert         string `yaml:"client_cert"`
+	ClientKey          string `yaml:"client_key"`
+	TLSServerName      string `yaml:"tls_server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// Supported Vault auth methods
+const (
+	VaultAuthAppRole    = "approle"
+	VaultAuthKubernetes = "kubernetes"
+)
+
+// VaultAuthConfig selects how latr authenticates to Vault
+// AppRole credentials are configured with VaultConfig.RoleID and VaultConfig.SecretID
+type VaultAuthConfig struct {
+	Method    string `yaml:"method"`     // approle (default) or kubernetes
+	MountPath string `yaml:"mount_path"` // Auth mount path, defaults to the method name
+	Role      string `yaml:"role"`       // Vault role for kubernetes auth
+	JWTPath   string `yaml:"jwt_path"`   // Service account token path for kubernetes auth
+}
+
+// KubernetesConfig contains Kubernetes API connection settings
+// When Kubeconfig is empty, in-cluster configuration is used
+type KubernetesConfig struct {
+	Kubeconfig string `yaml:"kubeconfig"`
+	Context    string `yaml:"context"`
 }
 
 // ObservabilityConfig contains settings for telemetry and logging
@@ -47,18 +186,81 @@ type ObservabilityConfig struct {
 
 // TokenConfig represents a single token to manage
 type TokenConfig struct {
-	Label             string          `yaml:"label"`
-	Team              string          `yaml:"team"`
-	Validity          string          `yaml:"validity"`
-	Scopes            string          `yaml:"scopes"`
-	RotationThreshold int             `yaml:"rotation_threshold"`
-	Storage           []StorageConfig `yaml:"storage"`
+	Label               string          `yaml:"label"`
+	Team                string          `yaml:"team"`
+	Validity            string          `yaml:"validity"`
+	Scopes              string          `yaml:"scopes"`
+	RotationThreshold   int             `yaml:"rotation_threshold"`
+	RevokePreviousAfter string          `yaml:"revoke_previous_after"`
+	OnStorageFailure    string          `yaml:"on_storage_failure"`
+	OnNonExpiring       string          `yaml:"on_non_expiring"`
+	Account             string          `yaml:"account"` // Linode account the token belongs to
+	Storage             []StorageConfig `yaml:"storage"`
+
+	// Source is the config file the token was loaded from
+	Source string `yaml:"-"`
 }
 
-// StorageConfig represents where to store the rotated token
-type StorageConfig struct {
-	Type string `yaml:"type"`
-	Path string `yaml:"path"`
+// AccountName returns the name of the Linode account the token belongs to
+func (t *TokenConfig) AccountName() string {
+	if t.Account == "" {
+		return DefaultAccount
+	}
+	return t.Account
+}
+
+// Account returns the configuration of the named Linode account
+func (c *Config) Account(name string) (AccountConfig, bool) {
+	if name == "" || name == DefaultAccount {
+		return c.Linode.AccountConfig, true
+	}
+	account, ok := c.Accounts[name]
+	return account, ok
+}
+
+// TokenAccounts returns the names of the Linode accounts that configured tokens belong to, sorted
+func (c *Config) TokenAccounts() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for i := range c.Tokens {
+		name := c.Tokens[i].AccountName()
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SelfToken returns the configuration of latr's own token for the named account, or
+// nil if it isn't managed
+func (c *Config) SelfToken(account string) *TokenConfig {
+	accountConfig, ok := c.Account(account)
+	if !ok || accountConfig.SelfToken == "" {
+		return nil
+	}
+	if account == "" {
+		account = DefaultAccount
+	}
+	for i := range c.Tokens {
+		if c.Tokens[i].Label == accountConfig.SelfToken && c.Tokens[i].AccountName() == account {
+			return &c.Tokens[i]
+		}
+	}
+	return nil
+}
+
+// UsesStorageType reports whether any configured token stores to the given storage type
+func (c *Config) UsesStorageType(storageType string) bool {
+	for _, token := range c.Tokens {
+		for _, storage := range token.Storage {
+			if storage.Type == storageType {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Parse parses YAML configuration data into a Config struct.
@@ -96,71 +298,511 @@ func (c *Config) ApplyDefaults() {
 	if c.Daemon.CheckInterval == "" {
 		c.Daemon.CheckInterval = "30m"
 	}
+	if c.Daemon.LeaderElection.Enabled {
+		c.Daemon.LeaderElection.applyDefaults()
+		if c.Daemon.LeaderElection.Backend == LeaderElectionVault {
+			c.Daemon.LeaderElection.Path = NormalizeVaultPath(c.Vault.MountPath, c.Daemon.LeaderElection.Path, 2)
+		}
+	}
 	if c.Rotation.ThresholdPercent == 0 {
 		c.Rotation.ThresholdPercent = 10
 	}
+	if c.Rotation.Lock.Backend == "" {
+		c.Rotation.Lock.Backend = LeaderElectionVault
+	}
+	if c.Rotation.Lock.Backend == LeaderElectionKubernetes && c.Rotation.Lock.Path == "" {
+		c.Rotation.Lock.Path = "latr-token"
+	}
+	if c.Rotation.Lock.LeaseDuration == "" {
+		c.Rotation.Lock.LeaseDuration = "5m"
+	}
+	if c.Rotation.Verify.Timeout == "" {
+		c.Rotation.Verify.Timeout = "1m"
+	}
+	if c.Linode.Retry.MaxAttempts == 0 {
+		c.Linode.Retry.MaxAttempts = 4
+	}
+	if c.Linode.Retry.InitialBackoff == "" {
+		c.Linode.Retry.InitialBackoff = "1s"
+	}
+	if c.Linode.Retry.MaxBackoff == "" {
+		c.Linode.Retry.MaxBackoff = "30s"
+	}
+	if c.Linode.TokenFile == "" && c.Linode.TokenVaultPath == "" && c.Linode.TokenEnv == "" {
+		c.Linode.TokenEnv = "LINODE_TOKEN"
+	}
 	if c.Vault.MountPath == "" {
 		c.Vault.MountPath = "secret"
 	}
+	if c.Vault.Auth.Method == "" {
+		c.Vault.Auth.Method = VaultAuthAppRole
+	}
+	if c.Vault.Auth.MountPath == "" {
+		c.Vault.Auth.MountPath = c.Vault.Auth.Method
+	}
+	if c.Vault.Auth.Method == VaultAuthKubernetes && c.Vault.Auth.JWTPath == "" {
+		c.Vault.Auth.JWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	}
 	if c.Observability.LogLevel == "" {
 		c.Observability.LogLevel = "info"
 	}
+
+	if c.Rotation.OnStorageFailure == "" {
+		c.Rotation.OnStorageFailure = StorageFailureKeep
+	}
+	if c.Rotation.OnNonExpiring == "" {
+		c.Rotation.OnNonExpiring = NonExpiringAdoptAndRotate
+	}
+	for i := range c.Tokens {
+		if c.Tokens[i].OnStorageFailure == "" {
+			c.Tokens[i].OnStorageFailure = c.Rotation.OnStorageFailure
+		}
+		if c.Tokens[i].OnNonExpiring == "" {
+			c.Tokens[i].OnNonExpiring = c.Rotation.OnNonExpiring
+		}
+	}
+
+	// Vault paths are stored relative to their mount
+	if c.Linode.TokenVaultPath != "" {
+		c.Linode.TokenVaultPath = NormalizeVaultPath(c.Vault.MountPath, c.Linode.TokenVaultPath, c.Vault.KVVersion)
+	}
+	for name, account := range c.Accounts {
+		if account.TokenVaultPath != "" {
+			account.TokenVaultPath = NormalizeVaultPath(c.Vault.MountPath, account.TokenVaultPath, c.Vault.KVVersion)
+			c.Accounts[name] = account
+		}
+	}
+	for i := range c.Tokens {
+		for j := range c.Tokens[i].Storage {
+			storage := &c.Tokens[i].Storage[j]
+			if storage.Type == StorageTypeVault {
+				storage.Path = NormalizeVaultPath(c.VaultMount(*storage), storage.Path, c.Vault.KVVersion)
+			}
+		}
+	}
 }
 
 // Validate checks that the configuration is valid
+// Every problem found is reported, joined into a single error
 func (c *Config) Validate() error {
+	var errs []error
+
 	// Validate Vault config
 	if c.Vault.Address == "" {
-		return fmt.Errorf("vault address is required")
+		errs = append(errs, fmt.Errorf("vault address is required"))
 	}
-	if c.Vault.RoleID == "" {
-		return fmt.Errorf("vault role_id is required")
+	switch c.Vault.Auth.Method {
+	case "", VaultAuthAppRole:
+		if c.Vault.RoleID == "" {
+			errs = append(errs, fmt.Errorf("vault role_id is required"))
+		}
+		if c.Vault.SecretID == "" {
+			errs = append(errs, fmt.Errorf("vault secret_id is required"))
+		}
+	case VaultAuthKubernetes:
+		if c.Vault.Auth.Role == "" {
+			errs = append(errs, fmt.Errorf("vault auth role is required for kubernetes auth"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported vault auth method %q (expected approle or kubernetes)", c.Vault.Auth.Method))
 	}
-	if c.Vault.SecretID == "" {
-		return fmt.Errorf("vault secret_id is required")
+	if c.Vault.KVVersion != 0 && c.Vault.KVVersion != 1 && c.Vault.KVVersion != 2 {
+		errs = append(errs, fmt.Errorf("vault kv_version must be 1 or 2, got %d", c.Vault.KVVersion))
+	}
+	if (c.Vault.ClientCert == "") != (c.Vault.ClientKey == "") {
+		errs = append(errs, fmt.Errorf("vault client_cert and client_key must be set together"))
+	}
+
+	if c.Daemon.LeaderElection.Enabled {
+		errs = append(errs, c.Daemon.LeaderElection.validate()...)
+	}
+
+	errs = append(errs, c.Rotation.Lock.validate(c.Vault.KVVersion)...)
+	errs = append(errs, c.Linode.Retry.validate()...)
+	errs = append(errs, c.Linode.validate("linode")...)
+	errs = append(errs, c.validateAccounts()...)
+	if c.Rotation.Verify.Timeout != "" {
+		if d, err := time.ParseDuration(c.Rotation.Verify.Timeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("rotation verify: invalid timeout %q", c.Rotation.Verify.Timeout))
+		}
+	}
+	if err := validateStorageFailurePolicy(c.Rotation.OnStorageFailure); err != nil {
+		errs = append(errs, fmt.Errorf("rotation: %w", err))
+	}
+	if err := validateNonExpiringPolicy(c.Rotation.OnNonExpiring); err != nil {
+		errs = append(errs, fmt.Errorf("rotation: %w", err))
 	}
 
 	// Validate tokens
 	if len(c.Tokens) == 0 {
-		return fmt.Errorf("at least one token must be configured")
+		errs = append(errs, fmt.Errorf("at least one token must be configured"))
 	}
 
-	for i, token := range c.Tokens {
-		if err := c.validateToken(&token, i); err != nil {
-			return err
+	for i := range c.Tokens {
+		errs = append(errs, c.validateToken(&c.Tokens[i], i)...)
+	}
+
+	errs = append(errs, c.validateUniqueness()...)
+	errs = append(errs, c.validateSelfToken()...)
+
+	return errors.Join(errs...)
+}
+
+// validateAccounts checks the named Linode accounts
+func (c *Config) validateAccounts() []error {
+	var errs []error
+	for _, name := range c.accountNames() {
+		account := c.Accounts[name]
+		ref := "accounts." + name
+
+		if name == DefaultAccount {
+			errs = append(errs, fmt.Errorf("%s: %q is reserved for the account configured under linode", ref, DefaultAccount))
+			continue
+		}
+		if !validAccountName.MatchString(name) {
+			errs = append(errs, fmt.Errorf("%s: account names must be lowercase letters, digits and dashes", ref))
 		}
+		// Only the default account falls back to LINODE_TOKEN
+		if account.TokenFile == "" && account.TokenVaultPath == "" && account.TokenEnv == "" {
+			errs = append(errs, fmt.Errorf("%s: one of token_file, token_vault_path and token_env is required", ref))
+		}
+		errs = append(errs, account.validate(ref)...)
 	}
+	return errs
+}
 
-	return nil
+// accountNames returns the names of the named accounts, sorted so errors are reported in order
+func (c *Config) accountNames() []string {
+	names := make([]string, 0, len(c.Accounts))
+	for name := range c.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func (c *Config) validateToken(token *TokenConfig, index int) error {
-	if token.Label == "" {
-		return fmt.Errorf("token[%d]: token label is required", index)
+// validateSelfToken checks that latr's own tokens can be read from Vault and can create tokens
+func (c *Config) validateSelfToken() []error {
+	var errs []error
+	for _, name := range append([]string{DefaultAccount}, c.accountNames()...) {
+		account, _ := c.Account(name)
+		if account.SelfToken == "" {
+			continue
+		}
+		ref := "linode"
+		if name != DefaultAccount {
+			ref = "accounts." + name
+		}
+
+		token := c.SelfToken(name)
+		if token == nil {
+			errs = append(errs, fmt.Errorf("%s: self_token %q doesn't match a configured token of the account", ref, account.SelfToken))
+			continue
+		}
+		// Creating tokens requires account access, checked only if the scopes parse
+		if scopes, err := linode.ParseScopes(token.Scopes); err == nil && !scopes.Allows("account", linode.ReadWrite) {
+			errs = append(errs, fmt.Errorf("%s: self_token %q needs account:read_write to create tokens, got %q", ref, token.Label, token.Scopes))
+		}
 	}
-	if token.Validity == "" {
-		return fmt.Errorf("token[%d]: token validity is required", index)
+	return errs
+}
+
+func (l *LeaderElectionConfig) applyDefaults() {
+	if l.Backend == "" {
+		l.Backend = LeaderElectionVault
+	}
+	if l.Path == "" {
+		switch l.Backend {
+		case LeaderElectionVault:
+			l.Path = "latr/leader"
+		case LeaderElectionKubernetes:
+			l.Path = "latr-leader"
+		}
+	}
+	if l.LeaseDuration == "" {
+		l.LeaseDuration = "60s"
+	}
+	if l.RenewInterval == "" {
+		l.RenewInterval = "20s"
+	}
+}
+
+func (l *LeaderElectionConfig) validate() []error {
+	var errs []error
+
+	switch l.Backend {
+	case "", LeaderElectionVault, LeaderElectionKubernetes:
+	case LeaderElectionFile:
+		if l.Path == "" {
+			errs = append(errs, fmt.Errorf("leader_election: path is required for the file backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("leader_election: unsupported backend %q (expected vault, kubernetes, or file)", l.Backend))
+	}
+
+	leaseDuration, err := time.ParseDuration(l.LeaseDuration)
+	if err != nil || leaseDuration <= 0 {
+		errs = append(errs, fmt.Errorf("leader_election: invalid lease_duration %q", l.LeaseDuration))
+	}
+	renewInterval, err := time.ParseDuration(l.RenewInterval)
+	if err != nil || renewInterval <= 0 {
+		errs = append(errs, fmt.Errorf("leader_election: invalid renew_interval %q", l.RenewInterval))
+	} else if leaseDuration > 0 && renewInterval >= leaseDuration {
+		errs = append(errs, fmt.Errorf("leader_election: renew_interval (%s) must be shorter than lease_duration (%s)", l.RenewInterval, l.LeaseDuration))
+	}
+
+	return errs
+}
+
+// validate checks the lock configuration, given the configured KV version (0 if detected)
+// Vault locks need check-and-set, so KV v1 requires choosing another backend.
+func (l *TokenLockConfig) validate(kvVersion int) []error {
+	var errs []error
+
+	switch l.Backend {
+	case "", LeaderElectionVault:
+		if kvVersion == 1 {
+			errs = append(errs, fmt.Errorf("rotation lock: the vault backend requires a KV v2 mount, but vault kv_version is 1 (set rotation.lock.backend to none, kubernetes or file)"))
+		}
+	case LeaderElectionKubernetes, TokenLockNone:
+	case LeaderElectionFile:
+		if l.Path == "" {
+			errs = append(errs, fmt.Errorf("rotation lock: path is required for the file backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("rotation lock: unsupported backend %q (expected vault, kubernetes, file, or none)", l.Backend))
+	}
+
+	if l.LeaseDuration != "" {
+		if d, err := time.ParseDuration(l.LeaseDuration); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("rotation lock: invalid lease_duration %q", l.LeaseDuration))
+		}
+	}
+
+	return errs
+}
+
+// validate checks that the account's API token is read from a single place and that
+// its API URL is usable. ref prefixes the errors.
+func (a *AccountConfig) validate(ref string) []error {
+	var errs []error
+
+	var sources []string
+	if a.TokenFile != "" {
+		sources = append(sources, "token_file")
+	}
+	if a.TokenVaultPath != "" {
+		sources = append(sources, "token_vault_path")
+	}
+	if a.TokenEnv != "" {
+		sources = append(sources, "token_env")
+	}
+	if len(sources) > 1 {
+		errs = append(errs, fmt.Errorf("%s: only one of token_file, token_vault_path and token_env can be set, got %s", ref, strings.Join(sources, ", ")))
+	}
+
+	if a.APIURL != "" {
+		if u, err := url.Parse(a.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s: invalid api_url %q (expected an http or https URL)", ref, a.APIURL))
+		}
+	}
+
+	return errs
+}
+
+func (r *LinodeRetryConfig) validate() []error {
+	var errs []error
+
+	if r.MaxAttempts < 0 {
+		errs = append(errs, fmt.Errorf("linode retry: max_attempts must be at least 1, got %d", r.MaxAttempts))
+	}
+
+	var initial, max time.Duration
+	var err error
+	if r.InitialBackoff != "" {
+		if initial, err = time.ParseDuration(r.InitialBackoff); err != nil || initial <= 0 {
+			errs = append(errs, fmt.Errorf("linode retry: invalid initial_backoff %q", r.InitialBackoff))
+		}
+	}
+	if r.MaxBackoff != "" {
+		if max, err = time.ParseDuration(r.MaxBackoff); err != nil || max <= 0 {
+			errs = append(errs, fmt.Errorf("linode retry: invalid max_backoff %q", r.MaxBackoff))
+		}
+	}
+	if initial > 0 && max > 0 && initial > max {
+		errs = append(errs, fmt.Errorf("linode retry: initial_backoff (%s) must not be longer than max_backoff (%s)", r.InitialBackoff, r.MaxBackoff))
+	}
+
+	return errs
+}
+
+// validateStorageFailurePolicy checks an on_storage_failure setting
+func validateStorageFailurePolicy(policy string) error {
+	switch policy {
+	case "", StorageFailureKeep, StorageFailureRollback:
+		return nil
+	default:
+		return fmt.Errorf("unsupported on_storage_failure %q (expected keep or rollback)", policy)
+	}
+}
+
+// validateNonExpiringPolicy checks an on_non_expiring setting
+func validateNonExpiringPolicy(policy string) error {
+	switch policy {
+	case "", NonExpiringAdoptAndRotate, NonExpiringIgnore, NonExpiringFail:
+		return nil
+	default:
+		return fmt.Errorf("unsupported on_non_expiring %q (expected adopt_and_rotate, ignore or fail)", policy)
+	}
+}
+
+func (c *Config) validateToken(token *TokenConfig, index int) []error {
+	var errs []error
+	ref := token.ref(index)
+
+	if token.Label == "" {
+		errs = append(errs, fmt.Errorf("%s: token label is required", ref))
 	}
 	if token.Scopes == "" {
-		return fmt.Errorf("token[%d]: token scopes is required", index)
+		errs = append(errs, fmt.Errorf("%s: token scopes is required", ref))
+	} else if _, err := linode.ParseScopes(token.Scopes); err != nil {
+		errs = append(errs, fmt.Errorf("%s: invalid scopes: %w", ref, err))
 	}
 	if len(token.Storage) == 0 {
-		return fmt.Errorf("token[%d]: at least one storage backend is required", index)
+		errs = append(errs, fmt.Errorf("%s: at least one storage backend is required", ref))
+	}
+	if _, ok := c.Account(token.Account); !ok {
+		errs = append(errs, fmt.Errorf("%s: unknown account %q", ref, token.Account))
+	}
+
+	for j, storage := range token.Storage {
+		if err := storage.Validate(BuiltinStorageTypes); err != nil {
+			errs = append(errs, fmt.Errorf("%s: storage[%d]: %w", ref, j, err))
+		}
+		if storage.Path == "" {
+			errs = append(errs, fmt.Errorf("%s: storage[%d]: storage path is required", ref, j))
+		}
+	}
+	// Token state, the pending token and the Vault lock are kept next to the first storage path
+	if len(token.Storage) > 0 && token.Storage[0].Type != StorageTypeVault {
+		errs = append(errs, fmt.Errorf("%s: storage[0]: the first storage entry must be vault, since token state is kept next to it, got %s",
+			ref, token.Storage[0].Type))
 	}
 
 	// Validate validity period
-	duration, err := ParseValidityDuration(token.Validity)
-	if err != nil {
-		return fmt.Errorf("token[%d]: invalid validity period: %w", index, err)
+	if token.Validity == "" {
+		errs = append(errs, fmt.Errorf("%s: token validity is required", ref))
+	} else if duration, err := ParseValidityDuration(token.Validity); err != nil {
+		errs = append(errs, fmt.Errorf("%s: invalid validity period: %w", ref, err))
+	} else if maxValidity := 180 * 24 * time.Hour; duration > maxValidity {
+		// Check that validity is <= 6 months (180 days)
+		errs = append(errs, fmt.Errorf("%s: validity period must be <= 6 months (180d), got %s", ref, token.Validity))
+	}
+
+	if err := validateStorageFailurePolicy(token.OnStorageFailure); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+	}
+	if err := validateNonExpiringPolicy(token.OnNonExpiring); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", ref, err))
 	}
 
-	// Check that validity is <= 6 months (180 days)
-	maxValidity := 180 * 24 * time.Hour
-	if duration > maxValidity {
-		return fmt.Errorf("token[%d]: validity period must be <= 6 months (180d), got %s", index, token.Validity)
+	if token.RevokePreviousAfter != "" {
+		if _, err := ParseValidityDuration(token.RevokePreviousAfter); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid revoke_previous_after: %w", ref, err))
+		}
 	}
 
-	return nil
+	return errs
+}
+
+// validateUniqueness checks for settings that must not be shared between tokens
+//
+// Labels identify tokens in a Linode account, so two entries with the same label in
+// the same account would fight over the same token. The paths of vault entries must be unique because token
+// state is keyed by the first one, so tokens sharing one would overwrite each other's state.
+func (c *Config) validateUniqueness() []error {
+	var errs []error
+	// The same label may be used in different accounts
+	type accountLabel struct{ account, label string }
+	labels := make(map[accountLabel]int)
+	// The same path may be reused in different Vault namespaces
+	type vaultLocation struct{ namespace, mount, path string }
+	vaultPaths := make(map[vaultLocation]int)
+
+	for i := range c.Tokens {
+		token := &c.Tokens[i]
+
+		if token.Label != "" {
+			key := accountLabel{account: token.AccountName(), label: token.Label}
+			if first, ok := labels[key]; ok {
+				errs = append(errs, fmt.Errorf("%s: duplicate label, already used by %s",
+					token.ref(i), c.Tokens[first].ref(first)))
+			} else {
+				labels[key] = i
+			}
+		}
+
+		// A token may list the same path twice, only report collisions between tokens
+		seen := make(map[vaultLocation]bool)
+		for _, storage := range token.Storage {
+			// Other backends don't live in Vault, their paths can't collide with state
+			if storage.Type != StorageTypeVault {
+				continue
+			}
+			mount := c.VaultMount(storage)
+			loc := vaultLocation{
+				namespace: strings.Trim(c.vaultNamespace(storage), "/"),
+				mount:     strings.Trim(mount, "/"),
+				path:      NormalizeVaultPath(mount, storage.Path, c.Vault.KVVersion),
+			}
+			if loc.path == "" || seen[loc] {
+				continue
+			}
+			seen[loc] = true
+
+			if first, ok := vaultPaths[loc]; ok {
+				path := loc.mount + "/" + loc.path
+				if loc.namespace != "" {
+					path = loc.namespace + "/" + path
+				}
+				errs = append(errs, fmt.Errorf("%s: vault path %q is already used by %s",
+					token.ref(i), path, c.Tokens[first].ref(first)))
+			} else {
+				vaultPaths[loc] = i
+			}
+		}
+	}
+
+	return errs
+}
+
+// vaultNamespace returns the Vault namespace a storage entry is written to
+func (c *Config) vaultNamespace(storage StorageConfig) string {
+	if ns := storage.VaultNamespace(); ns != "" {
+		return ns
+	}
+	return c.Vault.Namespace
+}
+
+// VaultMount returns the KV mount a storage entry is written to
+func (c *Config) VaultMount(storage StorageConfig) string {
+	if mount := storage.VaultMount(); mount != "" {
+		return mount
+	}
+	return c.Vault.MountPath
+}
+
+// ref returns a reference to the token for use in validation errors,
+// including its label and source file when known
+func (t *TokenConfig) ref(index int) string {
+	ref := fmt.Sprintf("token[%d]", index)
+	if t.Label != "" {
+		ref += fmt.Sprintf(" %q", t.Label)
+	}
+	if t.Source != "" {
+		ref += fmt.Sprintf(" (%s)", t.Source)
+	}
+	return ref
 }
 
 // ParseValidityDuration parses a validity string (e.g., "90d", "6mo") into a time.Duration
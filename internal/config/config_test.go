@@ -158,6 +158,665 @@ func TestValidateConfig_ValidityPeriodExactly6Months(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestValidateConfig_RevokePreviousAfter(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:   "https://vault.example.com",
+			RoleID:    "test-role-id",
+			SecretID:  "test-secret-id",
+			MountPath: "secret",
+		},
+		Tokens: []TokenConfig{
+			{
+				Label:               "test-token",
+				Team:                "platform-team",
+				Validity:            "90d",
+				Scopes:              "*",
+				RevokePreviousAfter: "24h",
+				Storage: []StorageConfig{
+					{Type: "vault", Path: "secret/data/linode/tokens/test"},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, cfg.Validate())
+
+	cfg.Tokens[0].RevokePreviousAfter = "tomorrow"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid revoke_previous_after")
+}
+
+func TestValidateConfig_VaultAuth(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:   "https://vault.example.com",
+			MountPath: "secret",
+			Auth: VaultAuthConfig{
+				Method: VaultAuthKubernetes,
+				Role:   "latr",
+			},
+		},
+		Tokens: []TokenConfig{
+			{Label: "test", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "path"}}},
+		},
+	}
+
+	// Kubernetes auth doesn't need AppRole credentials
+	require.NoError(t, cfg.Validate())
+
+	cfg.ApplyDefaults()
+	assert.Equal(t, "kubernetes", cfg.Vault.Auth.MountPath)
+	assert.Equal(t, "/var/run/secrets/kubernetes.io/serviceaccount/token", cfg.Vault.Auth.JWTPath)
+
+	cfg.Vault.Auth.Role = ""
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "vault auth role is required")
+
+	cfg.Vault.Auth.Method = "ldap"
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported vault auth method")
+}
+
+func TestValidateConfig_VaultTLS(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:    "https://vault.example.com",
+			RoleID:     "test-role-id",
+			SecretID:   "test-secret-id",
+			MountPath:  "secret",
+			CACert:     "/etc/latr/ca.pem",
+			ClientCert: "/etc/latr/client.pem",
+		},
+		Tokens: []TokenConfig{
+			{Label: "test", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "path"}}},
+		},
+	}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "vault client_cert and client_key must be set together")
+
+	cfg.Vault.ClientKey = "/etc/latr/client-key.pem"
+	require.NoError(t, cfg.Validate())
+
+	cfg.Vault.KVVersion = 3
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "vault kv_version must be 1 or 2, got 3")
+}
+
+func TestLeaderElectionConfig(t *testing.T) {
+	cfg := &Config{
+		Daemon: DaemonConfig{
+			LeaderElection: LeaderElectionConfig{Enabled: true},
+		},
+		Vault: VaultConfig{
+			Address:  "https://vault.example.com",
+			RoleID:   "test-role-id",
+			SecretID: "test-secret-id",
+		},
+		Tokens: []TokenConfig{
+			{Label: "test", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "path"}}},
+		},
+	}
+
+	cfg.ApplyDefaults()
+	assert.Equal(t, LeaderElectionVault, cfg.Daemon.LeaderElection.Backend)
+	assert.Equal(t, "latr/leader", cfg.Daemon.LeaderElection.Path)
+	assert.Equal(t, "60s", cfg.Daemon.LeaderElection.LeaseDuration)
+	assert.Equal(t, "20s", cfg.Daemon.LeaderElection.RenewInterval)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Daemon.LeaderElection = LeaderElectionConfig{
+		Enabled:       true,
+		Backend:       LeaderElectionFile,
+		LeaseDuration: "10s",
+		RenewInterval: "1m",
+	}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "leader_election: path is required for the file backend")
+	assert.Contains(t, err.Error(), "leader_election: renew_interval (1m) must be shorter than lease_duration (10s)")
+
+	cfg.Daemon.LeaderElection.Backend = "etcd"
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported backend "etcd"`)
+}
+
+func TestTokenLockConfig(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:  "https://vault.example.com",
+			RoleID:   "test-role-id",
+			SecretID: "test-secret-id",
+		},
+		Tokens: []TokenConfig{
+			{Label: "test", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "path"}}},
+		},
+	}
+
+	cfg.ApplyDefaults()
+	assert.Equal(t, LeaderElectionVault, cfg.Rotation.Lock.Backend)
+	assert.Equal(t, "5m", cfg.Rotation.Lock.LeaseDuration)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Rotation.Lock = TokenLockConfig{Backend: LeaderElectionFile, LeaseDuration: "soon"}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rotation lock: path is required for the file backend")
+	assert.Contains(t, err.Error(), `rotation lock: invalid lease_duration "soon"`)
+
+	cfg.Rotation.Lock = TokenLockConfig{Backend: TokenLockNone}
+	require.NoError(t, cfg.Validate())
+
+	// KV v1 can't hold vault locks, so another backend has to be chosen
+	cfg.Vault.KVVersion = 1
+	cfg.Rotation.Lock = TokenLockConfig{Backend: LeaderElectionVault, LeaseDuration: "5m"}
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rotation lock: the vault backend requires a KV v2 mount")
+
+	cfg.Rotation.Lock = TokenLockConfig{Backend: TokenLockNone}
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateConfig_Scopes(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:  "https://vault.example.com",
+			RoleID:   "test-role-id",
+			SecretID: "test-secret-id",
+		},
+		Tokens: []TokenConfig{
+			{Label: "valid", Team: "team", Validity: "90d", Scopes: "linodes:read_only, domains:read_write", Storage: []StorageConfig{{Type: "vault", Path: "a"}}},
+			{Label: "typo", Team: "team", Validity: "90d", Scopes: "linodes:read_only,domian:read_only", Storage: []StorageConfig{{Type: "vault", Path: "b"}}},
+		},
+	}
+	cfg.ApplyDefaults()
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid scopes: unknown resource "domian"`)
+	assert.NotContains(t, err.Error(), `"valid"`)
+}
+
+func TestVerifyConfig(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:  "https://vault.example.com",
+			RoleID:   "test-role-id",
+			SecretID: "test-secret-id",
+		},
+		Rotation: RotationConfig{Verify: VerifyConfig{Enabled: true}},
+		Tokens: []TokenConfig{
+			{Label: "test", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "path"}}},
+		},
+	}
+
+	cfg.ApplyDefaults()
+	assert.Equal(t, "1m", cfg.Rotation.Verify.Timeout)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Rotation.Verify.Timeout = "-5s"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `rotation verify: invalid timeout "-5s"`)
+}
+
+func TestLinodeRetryConfig(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:  "https://vault.example.com",
+			RoleID:   "test-role-id",
+			SecretID: "test-secret-id",
+		},
+		Tokens: []TokenConfig{
+			{Label: "test", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "path"}}},
+		},
+	}
+
+	cfg.ApplyDefaults()
+	assert.Equal(t, 4, cfg.Linode.Retry.MaxAttempts)
+	assert.Equal(t, "1s", cfg.Linode.Retry.InitialBackoff)
+	assert.Equal(t, "30s", cfg.Linode.Retry.MaxBackoff)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Linode.Retry.InitialBackoff = "1m"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "linode retry: initial_backoff (1m) must not be longer than max_backoff (30s)")
+
+	cfg.Linode.Retry.InitialBackoff = "soon"
+	cfg.Linode.Retry.MaxAttempts = -1
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `linode retry: invalid initial_backoff "soon"`)
+	assert.Contains(t, err.Error(), "linode retry: max_attempts must be at least 1, got -1")
+}
+
+func TestNonExpiringPolicy(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:  "https://vault.example.com",
+			RoleID:   "test-role-id",
+			SecretID: "test-secret-id",
+		},
+		Tokens: []TokenConfig{
+			{Label: "inherits", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "a"}}},
+			{Label: "overrides", Team: "team", Validity: "90d", Scopes: "*", OnNonExpiring: NonExpiringFail, Storage: []StorageConfig{{Type: "vault", Path: "b"}}},
+		},
+	}
+
+	cfg.ApplyDefaults()
+	assert.Equal(t, NonExpiringAdoptAndRotate, cfg.Tokens[0].OnNonExpiring)
+	assert.Equal(t, NonExpiringFail, cfg.Tokens[1].OnNonExpiring)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Rotation.OnNonExpiring = "adopt"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `rotation: unsupported on_non_expiring "adopt"`)
+}
+
+func TestLinodeTokenSource(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:   "https://vault.example.com",
+			RoleID:    "test-role-id",
+			SecretID:  "test-secret-id",
+			KVVersion: 2,
+		},
+		Tokens: []TokenConfig{
+			{Label: "test", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "path"}}},
+		},
+	}
+
+	cfg.ApplyDefaults()
+	assert.Equal(t, "LINODE_TOKEN", cfg.Linode.TokenEnv)
+	require.NoError(t, cfg.Validate())
+
+	// Vault paths are relative to the mount, like storage paths
+	cfg.Linode = LinodeConfig{AccountConfig: AccountConfig{TokenVaultPath: "secret/data/latr/linode"}}
+	cfg.ApplyDefaults()
+	assert.Empty(t, cfg.Linode.TokenEnv)
+	assert.Equal(t, "latr/linode", cfg.Linode.TokenVaultPath)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Linode.TokenFile = "/var/run/secrets/linode/token"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "linode: only one of token_file, token_vault_path and token_env can be set, got token_file, token_vault_path")
+}
+
+func TestSelfToken(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:  "https://vault.example.com",
+			RoleID:   "test-role-id",
+			SecretID: "test-secret-id",
+		},
+		Linode: LinodeConfig{AccountConfig: AccountConfig{SelfToken: "latr"}},
+		Tokens: []TokenConfig{
+			{Label: "app", Team: "team", Validity: "90d", Scopes: "linodes:read_only", Storage: []StorageConfig{{Type: "vault", Path: "app"}}},
+			{Label: "latr", Team: "platform", Validity: "30d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "latr"}}},
+		},
+	}
+
+	cfg.ApplyDefaults()
+	require.NoError(t, cfg.Validate())
+	require.NotNil(t, cfg.SelfToken(DefaultAccount))
+	assert.Equal(t, "latr", cfg.SelfToken(DefaultAccount).Label)
+
+	cfg.Tokens[1].Scopes = "linodes:read_write"
+	cfg.Tokens[1].Storage = []StorageConfig{{Type: "file", Path: "/tmp/latr"}}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `linode: self_token "latr" needs account:read_write to create tokens`)
+	assert.Contains(t, err.Error(), `token[1] "latr": storage[0]: the first storage entry must be vault`)
+
+	cfg.Linode.SelfToken = "missing"
+	assert.Nil(t, cfg.SelfToken(DefaultAccount))
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `linode: self_token "missing" doesn't match a configured token`)
+}
+
+func TestAccounts(t *testing.T) {
+	data := []byte(`
+vault:
+  address: "https://vault.example.com"
+  role_id: "test-role-id"
+  secret_id: "test-secret-id"
+  kv_version: 2
+linode:
+  token_file: /var/run/secrets/latr/linode-token
+accounts:
+  staging:
+    token_vault_path: secret/data/latr/staging
+    api_url: https://api.dev.linode.com
+    self_token: latr
+tokens:
+  - label: app
+    team: platform
+    validity: 90d
+    scopes: "*"
+    storage:
+      - type: vault
+        path: app/prod
+  - label: app
+    account: staging
+    team: platform
+    validity: 90d
+    scopes: "*"
+    storage:
+      - type: vault
+        path: app/staging
+  - label: latr
+    account: staging
+    team: platform
+    validity: 30d
+    scopes: "*"
+    storage:
+      - type: vault
+        path: latr/staging
+`)
+
+	cfg, err := Parse(data)
+	require.NoError(t, err)
+	cfg.ApplyDefaults()
+
+	// The default account is the one configured under linode
+	assert.Equal(t, "/var/run/secrets/latr/linode-token", cfg.Linode.TokenFile)
+	assert.Equal(t, "latr/staging", cfg.Accounts["staging"].TokenVaultPath)
+	assert.Equal(t, []string{DefaultAccount, "staging"}, cfg.TokenAccounts())
+	assert.Equal(t, DefaultAccount, cfg.Tokens[0].AccountName())
+	assert.Nil(t, cfg.SelfToken(DefaultAccount))
+	require.NotNil(t, cfg.SelfToken("staging"))
+	assert.Equal(t, "latr", cfg.SelfToken("staging").Label)
+
+	// Labels only have to be unique within an account
+	require.NoError(t, cfg.Validate())
+
+	cfg.Tokens[1].Account = "prod"
+	cfg.Accounts["default"] = AccountConfig{TokenEnv: "OTHER_TOKEN"}
+	cfg.Accounts["Dev_Account"] = AccountConfig{TokenEnv: "DEV_TOKEN", APIURL: "api.dev.linode.com"}
+	cfg.Accounts["qa"] = AccountConfig{}
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `token[1] "app": unknown account "prod"`)
+	assert.Contains(t, err.Error(), `accounts.default: "default" is reserved for the account configured under linode`)
+	assert.Contains(t, err.Error(), "accounts.Dev_Account: account names must be lowercase letters, digits and dashes")
+	assert.Contains(t, err.Error(), `accounts.Dev_Account: invalid api_url "api.dev.linode.com"`)
+	assert.Contains(t, err.Error(), "accounts.qa: one of token_file, token_vault_path and token_env is required")
+
+	cfg.Tokens[1].Account = ""
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `token[1] "app": duplicate label, already used by token[0] "app"`)
+}
+
+func TestStorageFailurePolicy(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:  "https://vault.example.com",
+			RoleID:   "test-role-id",
+			SecretID: "test-secret-id",
+		},
+		Rotation: RotationConfig{OnStorageFailure: StorageFailureRollback},
+		Tokens: []TokenConfig{
+			{Label: "inherits", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "a"}}},
+			{Label: "overrides", Team: "team", Validity: "90d", Scopes: "*", OnStorageFailure: StorageFailureKeep, Storage: []StorageConfig{{Type: "vault", Path: "b"}}},
+		},
+	}
+
+	cfg.ApplyDefaults()
+	assert.Equal(t, StorageFailureRollback, cfg.Tokens[0].OnStorageFailure)
+	assert.Equal(t, StorageFailureKeep, cfg.Tokens[1].OnStorageFailure)
+	require.NoError(t, cfg.Validate())
+
+	cfg.Tokens[1].OnStorageFailure = "retry"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported on_storage_failure "retry"`)
+}
+
+func TestParseKubernetesStorage(t *testing.T) {
+	yamlContent := `
+kubernetes:
+  kubeconfig: "/home/latr/.kube/config"
+  context: "prod"
+
+tokens:
+  - label: "test-token"
+    team: "platform-team"
+    validity: "90d"
+    scopes: "*"
+    storage:
+      - type: "vault"
+        path: "linode/tokens/test"
+      - type: "kubernetes"
+        namespace: "apps"
+        path: "linode-token"
+        key: "api-token"
+`
+
+	cfg, err := Parse([]byte(yamlContent))
+	require.NoError(t, err)
+
+	assert.Equal(t, "/home/latr/.kube/config", cfg.Kubernetes.Kubeconfig)
+	assert.Equal(t, "prod", cfg.Kubernetes.Context)
+
+	require.Len(t, cfg.Tokens[0].Storage, 2)
+	storage := cfg.Tokens[0].Storage[1]
+	assert.Equal(t, "kubernetes", storage.Type)
+	assert.Equal(t, "linode-token", storage.Path)
+
+	var opts KubernetesStorageOptions
+	require.NoError(t, storage.DecodeOptions(&opts))
+	assert.Equal(t, "apps", opts.Namespace)
+	assert.Equal(t, "api-token", opts.Key)
+
+	assert.True(t, cfg.UsesStorageType("kubernetes"))
+	assert.True(t, cfg.UsesStorageType("vault"))
+	assert.False(t, cfg.UsesStorageType("file"))
+}
+
+func TestValidateConfig_Storage(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage StorageConfig
+		errMsg  string
+	}{
+		{
+			name:    "valid file storage",
+			storage: StorageConfig{Type: "file", Path: "/run/secrets/linode", Options: map[string]interface{}{"mode": "0640", "format": "json"}},
+		},
+		{
+			name:    "invalid mode",
+			storage: StorageConfig{Type: "file", Path: "/run/secrets/linode", Options: map[string]interface{}{"mode": "rw-r-----"}},
+			errMsg:  "invalid file mode",
+		},
+		{
+			name:    "invalid format",
+			storage: StorageConfig{Type: "file", Path: "/run/secrets/linode", Options: map[string]interface{}{"format": "yaml"}},
+			errMsg:  "unsupported file format",
+		},
+		{
+			name:    "missing path",
+			storage: StorageConfig{Type: "file"},
+			errMsg:  "storage path is required",
+		},
+		{
+			name:    "unknown option",
+			storage: StorageConfig{Type: "file", Path: "/run/secrets/linode", Options: map[string]interface{}{"permissions": "0600"}},
+			errMsg:  "field permissions not found",
+		},
+		{
+			name:    "unknown storage type",
+			storage: StorageConfig{Type: "vualt", Path: "linode/tokens/test"},
+			errMsg:  `token[0] "test": storage[1]: unknown storage type "vualt" (supported: [file kubernetes vault])`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Vault: VaultConfig{
+					Address:   "https://vault.example.com",
+					RoleID:    "test-role-id",
+					SecretID:  "test-secret-id",
+					MountPath: "secret",
+				},
+				Tokens: []TokenConfig{
+					{Label: "test", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{
+						{Type: "vault", Path: "linode/tokens/test"},
+						tt.storage,
+					}},
+				},
+			}
+
+			err := cfg.Validate()
+			if tt.errMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestValidateConfig_FirstStorageMustBeVault(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:   "https://vault.example.com",
+			RoleID:    "test-role-id",
+			SecretID:  "test-secret-id",
+			MountPath: "secret",
+		},
+		Tokens: []TokenConfig{
+			{Label: "test", Team: "team", Validity: "90d", Scopes: "*", Storage: []StorageConfig{
+				{Type: "file", Path: "/etc/latr/token"},
+				{Type: "vault", Path: "linode/tokens/test"},
+			}},
+		},
+	}
+
+	// State kept under a local file path would end up in Vault at secret/etc/latr/token
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `token[0] "test": storage[0]: the first storage entry must be vault, since token state is kept next to it, got file`)
+
+	cfg.Tokens[0].Storage[0], cfg.Tokens[0].Storage[1] = cfg.Tokens[0].Storage[1], cfg.Tokens[0].Storage[0]
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateConfig_DuplicateLabelsAndPaths(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:   "https://vault.example.com",
+			RoleID:    "test-role-id",
+			SecretID:  "test-secret-id",
+			MountPath: "secret",
+		},
+		Tokens: []TokenConfig{
+			{Label: "token1", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "linode/tokens/a"}}},
+			{Label: "token1", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "linode/tokens/b"}}},
+			{Label: "token2", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "/linode/tokens/a/"}}},
+		},
+	}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `token[1] "token1": duplicate label, already used by token[0] "token1"`)
+	assert.Contains(t, err.Error(), `token[2] "token2": vault path "secret/linode/tokens/a" is already used by token[0] "token1"`)
+}
+
+func TestValidateConfig_KubernetesSecretsInDifferentNamespaces(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:   "https://vault.example.com",
+			RoleID:    "test-role-id",
+			SecretID:  "test-secret-id",
+			MountPath: "secret",
+		},
+		Tokens: []TokenConfig{
+			{Label: "team-a", Validity: "90d", Scopes: "*", Storage: []StorageConfig{
+				{Type: "vault", Path: "linode/tokens/team-a"},
+				{Type: "kubernetes", Path: "linode-token", Options: map[string]interface{}{"namespace": "team-a"}},
+			}},
+			{Label: "team-b", Validity: "90d", Scopes: "*", Storage: []StorageConfig{
+				{Type: "vault", Path: "linode/tokens/team-b"},
+				{Type: "kubernetes", Path: "linode-token", Options: map[string]interface{}{"namespace": "team-b"}},
+			}},
+		},
+	}
+
+	// Secret names aren't Vault paths, only the vault entries have to be unique
+	require.NoError(t, cfg.Validate())
+
+	// Without a vault entry there's nowhere to keep state, which is reported as such
+	cfg.Tokens[0].Storage = cfg.Tokens[0].Storage[1:]
+	cfg.Tokens[1].Storage = cfg.Tokens[1].Storage[1:]
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `token[0] "team-a": storage[0]: the first storage entry must be vault`)
+	assert.Contains(t, err.Error(), `token[1] "team-b": storage[0]: the first storage entry must be vault`)
+	assert.NotContains(t, err.Error(), "is already used by")
+}
+
+func TestValidateConfig_DuplicatePathsAcrossNamespaces(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address:   "https://vault.example.com",
+			RoleID:    "test-role-id",
+			SecretID:  "test-secret-id",
+			MountPath: "secret",
+			Namespace: "platform",
+		},
+		Tokens: []TokenConfig{
+			{Label: "token1", Validity: "90d", Scopes: "*", Storage: []StorageConfig{{Type: "vault", Path: "linode/token"}}},
+			{Label: "token2", Validity: "90d", Scopes: "*", Storage: []StorageConfig{
+				{Type: "vault", Path: "linode/token", Options: map[string]interface{}{"namespace": "team-a"}},
+			}},
+		},
+	}
+
+	// The same path in different namespaces doesn't collide
+	require.NoError(t, cfg.Validate())
+
+	cfg.Tokens[1].Storage[0].Options["namespace"] = "platform"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `vault path "platform/secret/linode/token" is already used by token[0] "token1"`)
+}
+
+func TestValidateConfig_CollectsAllErrors(t *testing.T) {
+	cfg := &Config{
+		Vault: VaultConfig{
+			Address: "https://vault.example.com",
+		},
+		Tokens: []TokenConfig{
+			{Label: "token1", Validity: "7mo", Scopes: "*", Storage: []StorageConfig{{Type: "vualt", Path: "linode/tokens/a"}, {Type: "vault"}}},
+			{Label: "token2", Validity: "90d", Storage: []StorageConfig{{Type: "vault", Path: "linode/tokens/b"}}},
+		},
+	}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "vault role_id is required")
+	assert.Contains(t, err.Error(), "vault secret_id is required")
+	assert.Contains(t, err.Error(), `token[0] "token1": storage[0]: unknown storage type "vualt"`)
+	assert.Contains(t, err.Error(), `token[0] "token1": storage[1]: storage path is required`)
+	assert.Contains(t, err.Error(), `token[0] "token1": validity period must be <= 6 months`)
+	assert.Contains(t, err.Error(), `token[1] "token2": token scopes is required`)
+}
+
 func TestValidateConfig_MissingRequiredFields(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -277,6 +936,58 @@ func TestValidateConfig_MissingRequiredFields(t *testing.T) {
 	}
 }
 
+func TestNormalizeVaultPath(t *testing.T) {
+	tests := []struct {
+		mount     string
+		path      string
+		kvVersion int
+		expected  string
+	}{
+		{"secret", "linode/tokens/dev", 0, "linode/tokens/dev"},
+		{"secret", "secret/data/linode/tokens/dev", 0, "linode/tokens/dev"},
+		{"secret", "/secret/data/linode/tokens/dev/", 2, "linode/tokens/dev"},
+		{"secret", "secret/linode/tokens/dev", 0, "linode/tokens/dev"},
+		{"secret/", "secret/data/linode/tokens/dev", 0, "linode/tokens/dev"},
+		{"kv", "kv/data/linode/tokens/dev", 1, "data/linode/tokens/dev"},
+		{"kv", "secret/data/linode/tokens/dev", 0, "secret/data/linode/tokens/dev"},
+		{"secret", "secretive/tokens", 0, "secretive/tokens"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NormalizeVaultPath(tt.mount, tt.path, tt.kvVersion))
+		})
+	}
+}
+
+func TestApplyDefaults_NormalizesVaultPaths(t *testing.T) {
+	cfg := &Config{
+		Tokens: []TokenConfig{
+			{
+				Label: "test",
+				Storage: []StorageConfig{
+					{Type: "vault", Path: "secret/data/linode/tokens/test"},
+					{Type: "vault", Path: "legacy/linode/tokens/test", Options: map[string]interface{}{"mount": "legacy"}},
+					{Type: "file", Path: "/run/secrets/secret/data/token"},
+				},
+			},
+		},
+	}
+
+	cfg.ApplyDefaults()
+
+	assert.Equal(t, "linode/tokens/test", cfg.Tokens[0].Storage[0].Path)
+	assert.Equal(t, "linode/tokens/test", cfg.Tokens[0].Storage[1].Path)
+	assert.Equal(t, "/run/secrets/secret/data/token", cfg.Tokens[0].Storage[2].Path)
+	assert.Equal(t, "legacy", cfg.VaultMount(cfg.Tokens[0].Storage[1]))
+
+	// The same path under different mounts doesn't collide
+	cfg.Vault = VaultConfig{Address: "https://vault.example.com", RoleID: "id", SecretID: "secret", MountPath: "secret"}
+	cfg.Tokens[0].Validity = "90d"
+	cfg.Tokens[0].Scopes = "*"
+	require.NoError(t, cfg.Validate())
+}
+
 func TestParseValidityDuration(t *testing.T) {
 	tests := []struct {
 		validity string
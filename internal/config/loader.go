@@ -18,6 +18,11 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
 	}
 
+	// Record where each token came from so validation errors can point to it
+	for i := range cfg.Tokens {
+		cfg.Tokens[i].Source = path
+	}
+
 	return cfg, nil
 }
 
@@ -65,12 +70,92 @@ func MergeConfigs(base, override *Config) *Config {
 	if override.Daemon.DryRun {
 		merged.Daemon.DryRun = override.Daemon.DryRun
 	}
+	if override.Daemon.LeaderElection.Enabled {
+		merged.Daemon.LeaderElection.Enabled = true
+	}
+	if override.Daemon.LeaderElection.Backend != "" {
+		merged.Daemon.LeaderElection.Backend = override.Daemon.LeaderElection.Backend
+	}
+	if override.Daemon.LeaderElection.Path != "" {
+		merged.Daemon.LeaderElection.Path = override.Daemon.LeaderElection.Path
+	}
+	if override.Daemon.LeaderElection.Namespace != "" {
+		merged.Daemon.LeaderElection.Namespace = override.Daemon.LeaderElection.Namespace
+	}
+	if override.Daemon.LeaderElection.Identity != "" {
+		merged.Daemon.LeaderElection.Identity = override.Daemon.LeaderElection.Identity
+	}
+	if override.Daemon.LeaderElection.LeaseDuration != "" {
+		merged.Daemon.LeaderElection.LeaseDuration = override.Daemon.LeaderElection.LeaseDuration
+	}
+	if override.Daemon.LeaderElection.RenewInterval != "" {
+		merged.Daemon.LeaderElection.RenewInterval = override.Daemon.LeaderElection.RenewInterval
+	}
 
 	// Merge Rotation config
 	merged.Rotation = base.Rotation
 	if override.Rotation.ThresholdPercent != 0 {
 		merged.Rotation.ThresholdPercent = override.Rotation.ThresholdPercent
 	}
+	if override.Rotation.OnStorageFailure != "" {
+		merged.Rotation.OnStorageFailure = override.Rotation.OnStorageFailure
+	}
+	if override.Rotation.OnNonExpiring != "" {
+		merged.Rotation.OnNonExpiring = override.Rotation.OnNonExpiring
+	}
+	if override.Rotation.Lock.Backend != "" {
+		merged.Rotation.Lock.Backend = override.Rotation.Lock.Backend
+	}
+	if override.Rotation.Lock.Path != "" {
+		merged.Rotation.Lock.Path = override.Rotation.Lock.Path
+	}
+	if override.Rotation.Lock.Namespace != "" {
+		merged.Rotation.Lock.Namespace = override.Rotation.Lock.Namespace
+	}
+	if override.Rotation.Lock.LeaseDuration != "" {
+		merged.Rotation.Lock.LeaseDuration = override.Rotation.Lock.LeaseDuration
+	}
+	if override.Rotation.Verify.Enabled {
+		merged.Rotation.Verify.Enabled = true
+	}
+	if override.Rotation.Verify.Timeout != "" {
+		merged.Rotation.Verify.Timeout = override.Rotation.Verify.Timeout
+	}
+
+	// Merge Linode config
+	merged.Linode = base.Linode
+	if override.Linode.Retry.MaxAttempts != 0 {
+		merged.Linode.Retry.MaxAttempts = override.Linode.Retry.MaxAttempts
+	}
+	if override.Linode.Retry.InitialBackoff != "" {
+		merged.Linode.Retry.InitialBackoff = override.Linode.Retry.InitialBackoff
+	}
+	if override.Linode.Retry.MaxBackoff != "" {
+		merged.Linode.Retry.MaxBackoff = override.Linode.Retry.MaxBackoff
+	}
+	if override.Linode.SelfToken != "" {
+		merged.Linode.SelfToken = override.Linode.SelfToken
+	}
+	if override.Linode.APIURL != "" {
+		merged.Linode.APIURL = override.Linode.APIURL
+	}
+	// The token source is replaced as a whole, since only one may be set
+	if override.Linode.TokenFile != "" || override.Linode.TokenVaultPath != "" || override.Linode.TokenEnv != "" {
+		merged.Linode.TokenFile = override.Linode.TokenFile
+		merged.Linode.TokenVaultPath = override.Linode.TokenVaultPath
+		merged.Linode.TokenEnv = override.Linode.TokenEnv
+	}
+
+	// Accounts are replaced as a whole, so an override can change an account's token source
+	if len(base.Accounts) > 0 || len(override.Accounts) > 0 {
+		merged.Accounts = make(map[string]AccountConfig, len(base.Accounts)+len(override.Accounts))
+		for name, account := range base.Accounts {
+			merged.Accounts[name] = account
+		}
+		for name, account := range override.Accounts {
+			merged.Accounts[name] = account
+		}
+	}
 
 	// Merge Vault config
 	merged.Vault = base.Vault
@@ -86,6 +171,51 @@ func MergeConfigs(base, override *Config) *Config {
 	if override.Vault.MountPath != "" {
 		merged.Vault.MountPath = override.Vault.MountPath
 	}
+	if override.Vault.Namespace != "" {
+		merged.Vault.Namespace = override.Vault.Namespace
+	}
+	if override.Vault.KVVersion != 0 {
+		merged.Vault.KVVersion = override.Vault.KVVersion
+	}
+	if override.Vault.Auth.Method != "" {
+		merged.Vault.Auth.Method = override.Vault.Auth.Method
+	}
+	if override.Vault.Auth.MountPath != "" {
+		merged.Vault.Auth.MountPath = override.Vault.Auth.MountPath
+	}
+	if override.Vault.Auth.Role != "" {
+		merged.Vault.Auth.Role = override.Vault.Auth.Role
+	}
+	if override.Vault.Auth.JWTPath != "" {
+		merged.Vault.Auth.JWTPath = override.Vault.Auth.JWTPath
+	}
+	if override.Vault.CACert != "" {
+		merged.Vault.CACert = override.Vault.CACert
+	}
+	if override.Vault.CAPath != "" {
+		merged.Vault.CAPath = override.Vault.CAPath
+	}
+	if override.Vault.ClientCert != "" {
+		merged.Vault.ClientCert = override.Vault.ClientCert
+	}
+	if override.Vault.ClientKey != "" {
+		merged.Vault.ClientKey = override.Vault.ClientKey
+	}
+	if override.Vault.TLSServerName != "" {
+		merged.Vault.TLSServerName = override.Vault.TLSServerName
+	}
+	if override.Vault.InsecureSkipVerify {
+		merged.Vault.InsecureSkipVerify = true
+	}
+
+	// Merge Kubernetes config
+	merged.Kubernetes = base.Kubernetes
+	if override.Kubernetes.Kubeconfig != "" {
+		merged.Kubernetes.Kubeconfig = override.Kubernetes.Kubeconfig
+	}
+	if override.Kubernetes.Context != "" {
+		merged.Kubernetes.Context = override.Kubernetes.Context
+	}
 
 	// Merge Observability config
 	merged.Observability = base.Observability
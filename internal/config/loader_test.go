@@ -105,6 +105,59 @@ tokens:
 	assert.Contains(t, labels, "token2")
 }
 
+func TestLoadAndValidate_DuplicatesAcrossFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	config1 := `
+vault:
+  address: "https://vault.example.com"
+  role_id: "test-role-id"
+  secret_id: "test-secret-id"
+
+tokens:
+  - label: "shared-token"
+    team: "team1"
+    validity: "90d"
+    scopes: "*"
+    storage:
+      - type: "vault"
+        path: "linode/tokens/shared"
+`
+
+	config2 := `
+tokens:
+  - label: "shared-token"
+    team: "team2"
+    validity: "90d"
+    scopes: "*"
+    storage:
+      - type: "vault"
+        path: "linode/tokens/other"
+  - label: "other-token"
+    team: "team2"
+    validity: "90d"
+    scopes: "*"
+    storage:
+      - type: "vault"
+        path: "linode/tokens/shared"
+`
+
+	path1 := filepath.Join(tmpDir, "a.yaml")
+	path2 := filepath.Join(tmpDir, "b.yaml")
+	require.NoError(t, os.WriteFile(path1, []byte(config1), 0644))
+	require.NoError(t, os.WriteFile(path2, []byte(config2), 0644))
+
+	cfg, err := LoadAndValidate(filepath.Join(tmpDir, "*.yaml"))
+	require.Error(t, err)
+	assert.Nil(t, cfg)
+
+	// Both problems are reported, each pointing at the files involved
+	assert.Contains(t, err.Error(),
+		`token[1] "shared-token" (`+path2+`): duplicate label, already used by token[0] "shared-token" (`+path1+`)`)
+	assert.Contains(t, err.Error(),
+		`token[2] "other-token" (`+path2+`): vault path "secret/linode/tokens/shared" is already used by token[0] "shared-token" (`+path1+`)`)
+}
+
 func TestLoadGlobNoMatches(t *testing.T) {
 	tmpDir := t.TempDir()
 	pattern := filepath.Join(tmpDir, "*.yaml")
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wbh1/latr/internal/file"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported storage backend types
+const (
+	StorageTypeVault      = "vault"
+	StorageTypeFile       = "file"
+	StorageTypeKubernetes = "kubernetes"
+)
+
+// StorageConfig represents where to store the rotated token
+//
+// Type and Path are common to all backends. Any other keys in the YAML entry are
+// backend-specific options, collected in Options and decoded with DecodeOptions
+// into the option struct for the storage type.
+type StorageConfig struct {
+	Type    string                 `yaml:"type"`
+	Path    string                 `yaml:"path"`
+	Options map[string]interface{} `yaml:",inline"`
+}
+
+// VaultStorageOptions contains options for "vault" storage
+type VaultStorageOptions struct {
+	Namespace string `yaml:"namespace"` // Vault Enterprise namespace, overrides vault.namespace
+	Mount     string `yaml:"mount"`     // KV mount, overrides vault.mount_path
+}
+
+// FileStorageOptions contains options for "file" storage
+type FileStorageOptions struct {
+	Mode   string `yaml:"mode"`   // Octal file mode, e.g. "0600"
+	Owner  string `yaml:"owner"`  // "user", "user:group", or "uid:gid"
+	Format string `yaml:"format"` // raw, env, or json
+	Key    string `yaml:"key"`    // Variable name (env) or field name (json)
+}
+
+// Validate checks the file storage options
+func (o *FileStorageOptions) Validate() error {
+	if _, err := file.ParseMode(o.Mode); err != nil {
+		return err
+	}
+	return file.ValidateFormat(o.Format)
+}
+
+// KubernetesStorageOptions contains options for "kubernetes" storage
+// The storage Path is the Secret name
+type KubernetesStorageOptions struct {
+	Namespace string `yaml:"namespace"` // Secret namespace, defaults to latr's own namespace
+	Key       string `yaml:"key"`       // Secret data key, defaults to "token"
+}
+
+// StorageTypes knows the storage types that can be used and the options each one takes
+// It's implemented by the storage registry, so storage types registered beyond the
+// built-in ones can be validated with ValidateStorage.
+type StorageTypes interface {
+	// NewOptions returns an empty options struct for storageType, or false if it isn't registered
+	NewOptions(storageType string) (interface{}, bool)
+	// Types returns the registered storage types in sorted order
+	Types() []string
+}
+
+// builtinStorageOptions maps each built-in storage type to a constructor for its options
+var builtinStorageOptions = map[string]func() interface{}{
+	StorageTypeVault:      func() interface{} { return &VaultStorageOptions{} },
+	StorageTypeFile:       func() interface{} { return &FileStorageOptions{} },
+	StorageTypeKubernetes: func() interface{} { return &KubernetesStorageOptions{} },
+}
+
+// BuiltinStorageTypes are the storage types latr ships with
+// Validate checks storage entries against them, and the default storage registry
+// takes its options from them.
+var BuiltinStorageTypes StorageTypes = builtinStorageTypes{}
+
+// builtinStorageTypes implements StorageTypes for the built-in storage types
+type builtinStorageTypes struct{}
+
+// NewOptions returns an empty options struct for a built-in storage type
+func (builtinStorageTypes) NewOptions(storageType string) (interface{}, bool) {
+	newOptions, ok := builtinStorageOptions[storageType]
+	if !ok {
+		return nil, false
+	}
+	return newOptions(), true
+}
+
+// Types returns the built-in storage types in sorted order
+func (builtinStorageTypes) Types() []string {
+	types := make([]string, 0, len(builtinStorageOptions))
+	for t := range builtinStorageOptions {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DecodeOptions decodes the backend-specific options into out
+// Unknown option keys are rejected so that typos are caught at load time.
+func (s StorageConfig) DecodeOptions(out interface{}) error {
+	if len(s.Options) == 0 {
+		return nil
+	}
+
+	data, err := yaml.Marshal(s.Options)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s storage options: %w", s.Type, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("invalid %s storage options: %w", s.Type, err)
+	}
+
+	return nil
+}
+
+// Validate checks that the storage type is registered and its options are valid
+func (s StorageConfig) Validate(types StorageTypes) error {
+	options, ok := types.NewOptions(s.Type)
+	if !ok {
+		return fmt.Errorf("unknown storage type %q (supported: %v)", s.Type, types.Types())
+	}
+
+	if err := s.DecodeOptions(options); err != nil {
+		return err
+	}
+
+	if v, ok := options.(interface{ Validate() error }); ok {
+		return v.Validate()
+	}
+
+	return nil
+}
+
+// ValidateStorage checks the options of storage entries whose type was registered
+// beyond the built-in ones, against the storage types that can be created
+// Entries of built-in types are checked by Validate. Every problem found is
+// reported, joined into a single error.
+func (c *Config) ValidateStorage(types StorageTypes) error {
+	var errs []error
+	for i := range c.Tokens {
+		token := &c.Tokens[i]
+		for j, storage := range token.Storage {
+			if _, ok := builtinStorageOptions[storage.Type]; ok {
+				continue
+			}
+			if err := storage.Validate(types); err != nil {
+				errs = append(errs, fmt.Errorf("%s: storage[%d]: %w", token.ref(i), j, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// VaultNamespace returns the Vault namespace override of a vault storage entry
+// It is empty for other storage types or when the global namespace applies
+func (s StorageConfig) VaultNamespace() string {
+	return s.vaultOptions().Namespace
+}
+
+// VaultMount returns the KV mount override of a vault storage entry
+// It is empty for other storage types or when vault.mount_path applies
+func (s StorageConfig) VaultMount() string {
+	return s.vaultOptions().Mount
+}
+
+// vaultOptions decodes the vault options, ignoring errors reported by Validate
+func (s StorageConfig) vaultOptions() VaultStorageOptions {
+	var opts VaultStorageOptions
+	if s.Type == StorageTypeVault {
+		_ = s.DecodeOptions(&opts)
+	}
+	return opts
+}
+
+// NormalizeVaultPath returns path relative to its KV mount
+// Paths may include the mount and, for KV v2, the "data/" API prefix
+// (e.g. "secret/data/linode/tokens/x"). Both are stripped since the Vault
+// client adds them itself.
+func NormalizeVaultPath(mount, path string, kvVersion int) string {
+	mount = strings.Trim(mount, "/")
+	path = strings.Trim(path, "/")
+
+	if rest, ok := strings.CutPrefix(path, mount+"/"); ok && mount != "" {
+		path = rest
+		// On KV v1 "data" is an ordinary path segment
+		if kvVersion != 1 {
+			path = strings.TrimPrefix(path, "data/")
+		}
+	}
+
+	return path
+}
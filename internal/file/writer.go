@@ -0,0 +1,241 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Supported output formats
+const (
+	FormatRaw  = "raw"
+	FormatEnv  = "env"
+	FormatJSON = "json"
+)
+
+// Default file settings
+const (
+	DefaultMode    os.FileMode = 0600
+	DefaultEnvKey              = "LINODE_TOKEN"
+	DefaultJSONKey             = "token"
+)
+
+// Options controls how a token file is written
+type Options struct {
+	Mode   os.FileMode // File permissions (defaults to 0600)
+	Owner  string      // Optional owner as "user", "user:group", or numeric "uid:gid"
+	Format string      // raw, env, or json (defaults to raw)
+	Key    string      // Variable name (env) or field name (json)
+}
+
+// ParseMode parses an octal file mode string such as "0640"
+// An empty string returns DefaultMode
+func ParseMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return DefaultMode, nil
+	}
+
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q: must be octal (e.g., 0600)", mode)
+	}
+	if m > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q: only permission bits are allowed", mode)
+	}
+
+	return os.FileMode(m), nil
+}
+
+// ValidateFormat checks that format is one of the supported output formats
+func ValidateFormat(format string) error {
+	switch format {
+	case "", FormatRaw, FormatEnv, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unsupported file format %q (expected raw, env, or json)", format)
+	}
+}
+
+// WriteToken atomically writes a token to path
+// The token is written to a temporary file in the same directory, which is then
+// renamed over the destination so readers never observe a partially written file.
+func WriteToken(path, token string, opts Options) error {
+	content, err := encode(token, opts)
+	if err != nil {
+		return err
+	}
+
+	mode := opts.Mode
+	if mode == 0 {
+		mode = DefaultMode
+	}
+
+	uid, gid, err := lookupOwner(opts.Owner)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	// Clean up the temporary file if anything fails before the rename
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if err := tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+
+	if uid != -1 || gid != -1 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			return fmt.Errorf("failed to set file owner: %w", err)
+		}
+	}
+
+	if _, err := tmp.Write(content); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync token file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close token file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move token file into place: %w", err)
+	}
+	committed = true
+
+	// Persist the rename itself
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// ReadToken reads a token previously written with WriteToken using the same options
+func ReadToken(path string, opts Options) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	return decode(data, opts)
+}
+
+// encode renders the token in the configured format
+func encode(token string, opts Options) ([]byte, error) {
+	switch opts.Format {
+	case "", FormatRaw:
+		return []byte(token + "\n"), nil
+	case FormatEnv:
+		return []byte(fmt.Sprintf("%s=%s\n", envKey(opts), token)), nil
+	case FormatJSON:
+		data, err := json.Marshal(map[string]string{jsonKey(opts): token})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode token as json: %w", err)
+		}
+		return append(data, '\n'), nil
+	default:
+		return nil, ValidateFormat(opts.Format)
+	}
+}
+
+// decode extracts the token from file contents in the configured format
+func decode(data []byte, opts Options) (string, error) {
+	switch opts.Format {
+	case "", FormatRaw:
+		return strings.TrimSpace(string(data)), nil
+	case FormatEnv:
+		key := envKey(opts)
+		for _, line := range strings.Split(string(data), "\n") {
+			name, value, found := strings.Cut(strings.TrimSpace(line), "=")
+			if found && name == key {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("variable %s not found in token file", key)
+	case FormatJSON:
+		var fields map[string]string
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return "", fmt.Errorf("failed to decode token file as json: %w", err)
+		}
+		token, ok := fields[jsonKey(opts)]
+		if !ok {
+			return "", fmt.Errorf("field %s not found in token file", jsonKey(opts))
+		}
+		return token, nil
+	default:
+		return "", ValidateFormat(opts.Format)
+	}
+}
+
+func envKey(opts Options) string {
+	if opts.Key != "" {
+		return opts.Key
+	}
+	return DefaultEnvKey
+}
+
+func jsonKey(opts Options) string {
+	if opts.Key != "" {
+		return opts.Key
+	}
+	return DefaultJSONKey
+}
+
+// lookupOwner resolves an owner string to a uid and gid
+// -1 is returned for any part that should be left unchanged
+func lookupOwner(owner string) (int, int, error) {
+	if owner == "" {
+		return -1, -1, nil
+	}
+
+	userPart, groupPart, _ := strings.Cut(owner, ":")
+
+	uid := -1
+	if userPart != "" {
+		id, err := strconv.Atoi(userPart)
+		if err != nil {
+			u, err := user.Lookup(userPart)
+			if err != nil {
+				return -1, -1, fmt.Errorf("unknown user %q: %w", userPart, err)
+			}
+			id, _ = strconv.Atoi(u.Uid)
+		}
+		uid = id
+	}
+
+	gid := -1
+	if groupPart != "" {
+		id, err := strconv.Atoi(groupPart)
+		if err != nil {
+			g, err := user.LookupGroup(groupPart)
+			if err != nil {
+				return -1, -1, fmt.Errorf("unknown group %q: %w", groupPart, err)
+			}
+			id, _ = strconv.Atoi(g.Gid)
+		}
+		gid = id
+	}
+
+	return uid, gid, nil
+}
@@ -0,0 +1,155 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteToken_Formats(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{
+			name:     "raw by default",
+			opts:     Options{},
+			expected: "my-secret-token\n",
+		},
+		{
+			name:     "env with default key",
+			opts:     Options{Format: FormatEnv},
+			expected: "LINODE_TOKEN=my-secret-token\n",
+		},
+		{
+			name:     "env with custom key",
+			opts:     Options{Format: FormatEnv, Key: "API_TOKEN"},
+			expected: "API_TOKEN=my-secret-token\n",
+		},
+		{
+			name:     "json with default key",
+			opts:     Options{Format: FormatJSON},
+			expected: `{"token":"my-secret-token"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "token")
+
+			err := WriteToken(path, "my-secret-token", tt.opts)
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(data))
+
+			// Reading back with the same options returns the token
+			token, err := ReadToken(path, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, "my-secret-token", token)
+		})
+	}
+}
+
+func TestWriteToken_JSONCustomKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+
+	err := WriteToken(path, "my-secret-token", Options{Format: FormatJSON, Key: "linode_token"})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var fields map[string]string
+	require.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, "my-secret-token", fields["linode_token"])
+}
+
+func TestWriteToken_Mode(t *testing.T) {
+	dir := t.TempDir()
+
+	defaultPath := filepath.Join(dir, "default")
+	require.NoError(t, WriteToken(defaultPath, "token", Options{}))
+	info, err := os.Stat(defaultPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	customPath := filepath.Join(dir, "custom")
+	require.NoError(t, WriteToken(customPath, "token", Options{Mode: 0640}))
+	info, err = os.Stat(customPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+func TestWriteToken_ReplacesExistingFileAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+
+	require.NoError(t, WriteToken(path, "old-token", Options{}))
+	require.NoError(t, WriteToken(path, "new-token", Options{}))
+
+	token, err := ReadToken(path, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "new-token", token)
+
+	// No temporary files should be left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "token", entries[0].Name())
+}
+
+func TestWriteToken_Owner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+
+	// Chown to the current user and group is always permitted
+	owner := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	require.NoError(t, WriteToken(path, "token", Options{Owner: owner}))
+
+	err := WriteToken(path, "token", Options{Owner: "no-such-user-latr"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown user")
+}
+
+func TestWriteToken_MissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "token")
+
+	err := WriteToken(path, "token", Options{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create temporary file")
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected os.FileMode
+		hasError bool
+	}{
+		{"", 0600, false},
+		{"0600", 0600, false},
+		{"640", 0640, false},
+		{"0644", 0644, false},
+		{"rw-r--r--", 0, true},
+		{"0999", 0, true},
+		{"01777", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			mode, err := ParseMode(tt.mode)
+			if tt.hasError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, mode)
+			}
+		})
+	}
+}
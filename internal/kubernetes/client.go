@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// namespaceFile is where Kubernetes mounts the pod's namespace for in-cluster workloads
+const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Config holds Kubernetes client configuration
+type Config struct {
+	Kubeconfig string // Path to a kubeconfig file. Empty uses in-cluster config, then default loading rules
+	Context    string // Optional kubeconfig context
+}
+
+// Client wraps the Kubernetes clientset for managing Secrets
+type Client struct {
+	clientset        kubernetes.Interface
+	defaultNamespace string
+}
+
+// NewClient creates a new Kubernetes client
+//
+// When no kubeconfig is given, in-cluster configuration is tried first so that
+// latr works out of the box when deployed with the Helm chart. Otherwise the
+// standard kubeconfig loading rules ($KUBECONFIG, ~/.kube/config) apply.
+func NewClient(config *Config) (*Client, error) {
+	restConfig, namespace, err := loadRESTConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return NewClientFromClientset(clientset, namespace), nil
+}
+
+// NewClientFromClientset creates a client from an existing clientset
+// defaultNamespace is used for Secrets that don't specify a namespace
+func NewClientFromClientset(clientset kubernetes.Interface, defaultNamespace string) *Client {
+	if defaultNamespace == "" {
+		defaultNamespace = metav1.NamespaceDefault
+	}
+
+	return &Client{
+		clientset:        clientset,
+		defaultNamespace: defaultNamespace,
+	}
+}
+
+// loadRESTConfig resolves the REST config and the namespace to use by default
+func loadRESTConfig(config *Config) (*rest.Config, string, error) {
+	if config.Kubeconfig == "" {
+		if restConfig, err := rest.InClusterConfig(); err == nil {
+			namespace := metav1.NamespaceDefault
+			if data, err := os.ReadFile(namespaceFile); err == nil {
+				namespace = strings.TrimSpace(string(data))
+			}
+			return restConfig, namespace, nil
+		}
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = config.Kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: config.Context}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return restConfig, namespace, nil
+}
+
+// ErrNotFound is returned by ReadSecretKey when the Secret or the key doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// WriteSecretKey sets key in the named Secret to value
+// The Secret is created if it doesn't exist, otherwise only the given key is patched
+// so that other keys in the Secret are left untouched.
+func (c *Client) WriteSecretKey(ctx context.Context, namespace, name, key, value string) error {
+	if namespace == "" {
+		namespace = c.defaultNamespace
+	}
+	secrets := c.clientset.CoreV1().Secrets(namespace)
+
+	_, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/managed-by": "latr",
+				},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				key: []byte(value),
+			},
+		}
+
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+		if err == nil {
+			return nil
+		}
+		// Someone else created it in the meantime, fall through to patching
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create secret %s/%s: %w", namespace, name, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+
+	// Secret data is base64 encoded by encoding/json since the values are []byte
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": map[string][]byte{
+			key: []byte(value),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build secret patch: %w", err)
+	}
+
+	_, err = secrets.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch secret %s/%s: %w", namespace, name, err)
+	}
+
+	return nil
+}
+
+// DeleteSecretKey removes key from the named Secret
+// The Secret itself is kept, and a missing Secret is not an error
+func (c *Client) DeleteSecretKey(ctx context.Context, namespace, name, key string) error {
+	if namespace == "" {
+		namespace = c.defaultNamespace
+	}
+
+	// A null value removes the key in a JSON merge patch
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": map[string]interface{}{
+			key: nil,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build secret patch: %w", err)
+	}
+
+	_, err = c.clientset.CoreV1().Secrets(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to patch secret %s/%s: %w", namespace, name, err)
+	}
+
+	return nil
+}
+
+// ReadSecretKey reads key from the named Secret
+func (c *Client) ReadSecretKey(ctx context.Context, namespace, name, key string) (string, error) {
+	if namespace == "" {
+		namespace = c.defaultNamespace
+	}
+
+	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s %w in secret %s/%s", key, ErrNotFound, namespace, name)
+	}
+
+	return string(value), nil
+}
@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWriteSecretKey_CreatesSecret(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	client := NewClientFromClientset(clientset, "latr")
+
+	ctx := context.Background()
+	err := client.WriteSecretKey(ctx, "apps", "linode-token", "token", "my-secret-token")
+	require.NoError(t, err)
+
+	secret, err := clientset.CoreV1().Secrets("apps").Get(ctx, "linode-token", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "my-secret-token", string(secret.Data["token"]))
+	assert.Equal(t, corev1.SecretTypeOpaque, secret.Type)
+	assert.Equal(t, "latr", secret.Labels["app.kubernetes.io/managed-by"])
+}
+
+func TestWriteSecretKey_PatchesExistingSecret(t *testing.T) {
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "linode-token",
+			Namespace: "apps",
+		},
+		Data: map[string][]byte{
+			"token": []byte("old-token"),
+			"other": []byte("untouched"),
+		},
+	}
+	clientset := fake.NewSimpleClientset(existing)
+	client := NewClientFromClientset(clientset, "latr")
+
+	ctx := context.Background()
+	err := client.WriteSecretKey(ctx, "apps", "linode-token", "token", "new-token")
+	require.NoError(t, err)
+
+	secret, err := clientset.CoreV1().Secrets("apps").Get(ctx, "linode-token", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "new-token", string(secret.Data["token"]))
+	assert.Equal(t, "untouched", string(secret.Data["other"]))
+}
+
+func TestWriteSecretKey_DefaultNamespace(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	client := NewClientFromClientset(clientset, "latr")
+
+	ctx := context.Background()
+	err := client.WriteSecretKey(ctx, "", "linode-token", "token", "my-secret-token")
+	require.NoError(t, err)
+
+	value, err := client.ReadSecretKey(ctx, "latr", "linode-token", "token")
+	require.NoError(t, err)
+	assert.Equal(t, "my-secret-token", value)
+}
+
+func TestReadSecretKey_MissingKey(t *testing.T) {
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "linode-token",
+			Namespace: "apps",
+		},
+		Data: map[string][]byte{
+			"other": []byte("value"),
+		},
+	}
+	client := NewClientFromClientset(fake.NewSimpleClientset(existing), "latr")
+
+	value, err := client.ReadSecretKey(context.Background(), "apps", "linode-token", "token")
+	require.Error(t, err)
+	assert.Empty(t, value)
+	assert.Contains(t, err.Error(), "key token not found")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestReadSecretKey_NotFound(t *testing.T) {
+	client := NewClientFromClientset(fake.NewSimpleClientset(), "latr")
+
+	_, err := client.ReadSecretKey(context.Background(), "apps", "missing", "token")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get secret")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDeleteSecretKey(t *testing.T) {
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "linode-token",
+			Namespace: "apps",
+		},
+		Data: map[string][]byte{
+			"token": []byte("my-secret-token"),
+			"other": []byte("untouched"),
+		},
+	}
+	clientset := fake.NewSimpleClientset(existing)
+	client := NewClientFromClientset(clientset, "latr")
+
+	ctx := context.Background()
+	err := client.DeleteSecretKey(ctx, "apps", "linode-token", "token")
+	require.NoError(t, err)
+
+	secret, err := clientset.CoreV1().Secrets("apps").Get(ctx, "linode-token", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, secret.Data, "token")
+	assert.Equal(t, "untouched", string(secret.Data["other"]))
+
+	// Deleting from a missing Secret is a no-op
+	err = client.DeleteSecretKey(ctx, "apps", "missing", "token")
+	require.NoError(t, err)
+}
@@ -0,0 +1,126 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TryAcquireLease takes the named Lease for holder, or renews it if holder already owns it
+// It returns false if another holder's lease hasn't expired yet, or if another
+// replica updated the Lease first.
+func (c *Client) TryAcquireLease(ctx context.Context, namespace, name, holder string, ttl time.Duration) (bool, error) {
+	if namespace == "" {
+		namespace = c.defaultNamespace
+	}
+	leases := c.clientset.CoordinationV1().Leases(namespace)
+
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(math.Ceil(ttl.Seconds()))
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/managed-by": "latr",
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to create lease %s/%s: %w", namespace, name, err)
+		}
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get lease %s/%s: %w", namespace, name, err)
+	}
+
+	current := ""
+	if lease.Spec.HolderIdentity != nil {
+		current = *lease.Spec.HolderIdentity
+	}
+	if current != "" && current != holder && !leaseExpired(lease, now.Time) {
+		return false, nil
+	}
+
+	if current != holder {
+		lease.Spec.AcquireTime = &now
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions += *lease.Spec.LeaseTransitions
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+
+	// The update carries the resourceVersion that was read, so a concurrent change makes it conflict
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update lease %s/%s: %w", namespace, name, err)
+	}
+
+	return true, nil
+}
+
+// ReleaseLease clears the holder of the named Lease if holder owns it, so a standby can take over right away
+func (c *Client) ReleaseLease(ctx context.Context, namespace, name, holder string) error {
+	if namespace == "" {
+		namespace = c.defaultNamespace
+	}
+	leases := c.clientset.CoordinationV1().Leases(namespace)
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get lease %s/%s: %w", namespace, name, err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+		return nil
+	}
+
+	lease.Spec.HolderIdentity = nil
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	// Someone else took the Lease over in the meantime
+	if apierrors.IsConflict(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update lease %s/%s: %w", namespace, name, err)
+	}
+
+	return nil
+}
+
+// leaseExpired reports whether the lease wasn't renewed within its duration
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiresAt := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return now.After(expiresAt)
+}
@@ -0,0 +1,71 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTryAcquireLease(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	client := NewClientFromClientset(clientset, "latr")
+
+	ctx := context.Background()
+
+	acquired, err := client.TryAcquireLease(ctx, "", "latr-leader", "replica-a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	lease, err := clientset.CoordinationV1().Leases("latr").Get(ctx, "latr-leader", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "replica-a", *lease.Spec.HolderIdentity)
+	assert.Equal(t, int32(60), *lease.Spec.LeaseDurationSeconds)
+
+	// The holder can renew, others have to wait for the lease to lapse
+	acquired, err = client.TryAcquireLease(ctx, "", "latr-leader", "replica-a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = client.TryAcquireLease(ctx, "", "latr-leader", "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, client.ReleaseLease(ctx, "", "latr-leader", "replica-a"))
+
+	acquired, err = client.TryAcquireLease(ctx, "", "latr-leader", "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	lease, err = clientset.CoordinationV1().Leases("latr").Get(ctx, "latr-leader", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "replica-b", *lease.Spec.HolderIdentity)
+	assert.Equal(t, int32(1), *lease.Spec.LeaseTransitions)
+}
+
+func TestTryAcquireLease_ExpiredLeaseIsTakenOver(t *testing.T) {
+	holder := "replica-a"
+	seconds := int32(30)
+	renewed := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	existing := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "latr-leader",
+			Namespace: "latr",
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			RenewTime:            &renewed,
+		},
+	}
+	client := NewClientFromClientset(fake.NewSimpleClientset(existing), "latr")
+
+	acquired, err := client.TryAcquireLease(context.Background(), "latr", "latr-leader", "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
@@ -0,0 +1,153 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Guard file settings
+const (
+	guardRetryInterval = 10 * time.Millisecond
+	staleGuardAge      = 10 * time.Second
+)
+
+// fileRecord is the content of a lock file
+type fileRecord struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// File is a lock kept in a local file, for single-host setups and tests
+//
+// The record is only changed while holding a guard file created with O_EXCL,
+// so processes sharing the lock never interleave their read-modify-write.
+type File struct {
+	path string
+}
+
+// NewFile creates a lock stored at path
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// TryAcquire takes or renews the lock
+func (f *File) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	acquired := false
+	err := f.update(ctx, func(record *fileRecord) bool {
+		now := time.Now()
+		if record.Holder != "" && record.Holder != holder && now.Before(record.ExpiresAt) {
+			return false
+		}
+		record.Holder = holder
+		record.ExpiresAt = now.Add(ttl)
+		acquired = true
+		return true
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock file %s: %w", f.path, err)
+	}
+
+	return acquired, nil
+}
+
+// Release expires the lock if holder owns it
+func (f *File) Release(ctx context.Context, holder string) error {
+	err := f.update(ctx, func(record *fileRecord) bool {
+		if record.Holder != holder {
+			return false
+		}
+		*record = fileRecord{ExpiresAt: time.Now()}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release lock file %s: %w", f.path, err)
+	}
+
+	return nil
+}
+
+// Describe returns the lock file path
+func (f *File) Describe() string {
+	return fmt.Sprintf("file:%s", f.path)
+}
+
+// update applies fn to the lock record under the guard, writing it back if fn returns true
+func (f *File) update(ctx context.Context, fn func(record *fileRecord) bool) error {
+	unlock, err := f.guard(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var record fileRecord
+	data, err := os.ReadFile(f.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("invalid lock file: %w", err)
+		}
+	}
+
+	if !fn(&record) {
+		return nil
+	}
+
+	data, err = json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	// Write through a temporary file so the record is never seen half-written
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), "."+filepath.Base(f.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// guard creates the guard file, waiting while another process holds it
+// Guards left behind by a crashed process are removed once they're stale.
+func (f *File) guard(ctx context.Context) (func(), error) {
+	guardPath := f.path + ".guard"
+
+	for {
+		g, err := os.OpenFile(guardPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			g.Close()
+			return func() { os.Remove(guardPath) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(guardPath); err == nil && time.Since(info.ModTime()) > staleGuardAge {
+			os.Remove(guardPath)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(guardRetryInterval):
+		}
+	}
+}
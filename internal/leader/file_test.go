@@ -0,0 +1,82 @@
+package leader
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile_AcquireRenewRelease(t *testing.T) {
+	lock := NewFile(filepath.Join(t.TempDir(), "leader.lock"))
+	ctx := context.Background()
+
+	acquired, err := lock.TryAcquire(ctx, "replica-a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// The holder can renew, others have to wait for the lease to lapse
+	acquired, err = lock.TryAcquire(ctx, "replica-a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = lock.TryAcquire(ctx, "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	// Releasing by a non-holder is a no-op
+	require.NoError(t, lock.Release(ctx, "replica-b"))
+	acquired, err = lock.TryAcquire(ctx, "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, lock.Release(ctx, "replica-a"))
+	acquired, err = lock.TryAcquire(ctx, "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestFile_ExpiredLeaseIsTakenOver(t *testing.T) {
+	lock := NewFile(filepath.Join(t.TempDir(), "leader.lock"))
+	ctx := context.Background()
+
+	acquired, err := lock.TryAcquire(ctx, "replica-a", time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	time.Sleep(5 * time.Millisecond)
+
+	acquired, err = lock.TryAcquire(ctx, "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestFile_OnlyOneConcurrentWinner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lock")
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	results := make([]bool, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			acquired, err := NewFile(path).TryAcquire(ctx, string(rune('a'+i)), time.Minute)
+			assert.NoError(t, err)
+			results[i] = acquired
+		}(i)
+	}
+	wg.Wait()
+
+	winners := 0
+	for _, acquired := range results {
+		if acquired {
+			winners++
+		}
+	}
+	assert.Equal(t, 1, winners)
+}
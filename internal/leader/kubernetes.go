@@ -0,0 +1,49 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// KubernetesClient defines the Kubernetes Lease operations used by the Kubernetes lock
+type KubernetesClient interface {
+	TryAcquireLease(ctx context.Context, namespace, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, namespace, name, holder string) error
+}
+
+// Kubernetes is a lock backed by a coordination.k8s.io Lease
+type Kubernetes struct {
+	client    KubernetesClient
+	namespace string
+	name      string
+}
+
+// NewKubernetes creates a lock using the named Lease
+// An empty namespace uses the client's default namespace
+func NewKubernetes(client KubernetesClient, namespace, name string) *Kubernetes {
+	return &Kubernetes{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// TryAcquire takes or renews the Lease
+func (k *Kubernetes) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	return k.client.TryAcquireLease(ctx, k.namespace, k.name, holder, ttl)
+}
+
+// Release gives up the Lease
+func (k *Kubernetes) Release(ctx context.Context, holder string) error {
+	return k.client.ReleaseLease(ctx, k.namespace, k.name, holder)
+}
+
+// Describe returns the Lease namespace and name
+func (k *Kubernetes) Describe() string {
+	namespace := k.namespace
+	if namespace == "" {
+		namespace = "<default>"
+	}
+	return fmt.Sprintf("kubernetes:%s/%s", namespace, k.name)
+}
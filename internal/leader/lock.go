@@ -0,0 +1,41 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wbh1/latr/internal/config"
+)
+
+// Lock is a lease-style lock that replicas compete for to become the leader
+type Lock interface {
+	// TryAcquire takes the lock for holder until ttl from now, or renews it if holder already owns it
+	// It returns false without an error while another holder's lease is still valid.
+	TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lock if holder owns it
+	Release(ctx context.Context, holder string) error
+	// Describe returns a human-readable description of the lock for logs
+	Describe() string
+}
+
+// New creates the Lock for a leader election configuration
+// vaultClient and kubeClient may be nil if the backend doesn't use them
+func New(cfg config.LeaderElectionConfig, vaultClient VaultClient, kubeClient KubernetesClient) (Lock, error) {
+	switch cfg.Backend {
+	case "", config.LeaderElectionVault:
+		if vaultClient == nil {
+			return nil, fmt.Errorf("no vault client is available")
+		}
+		return NewVault(vaultClient, cfg.Path), nil
+	case config.LeaderElectionKubernetes:
+		if kubeClient == nil {
+			return nil, fmt.Errorf("no kubernetes client is available")
+		}
+		return NewKubernetes(kubeClient, cfg.Namespace, cfg.Path), nil
+	case config.LeaderElectionFile:
+		return NewFile(cfg.Path), nil
+	default:
+		return nil, fmt.Errorf("unsupported leader election backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,64 @@
+package leader
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wbh1/latr/internal/config"
+)
+
+type fakeVaultClient struct{}
+
+func (fakeVaultClient) TryAcquireLock(ctx context.Context, path, holder string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (fakeVaultClient) ReleaseLock(ctx context.Context, path, holder string) error {
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	lock, err := New(config.LeaderElectionConfig{Backend: config.LeaderElectionVault, Path: "latr/leader"}, fakeVaultClient{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "vault:latr/leader", lock.Describe())
+
+	lock, err = New(config.LeaderElectionConfig{Backend: config.LeaderElectionFile, Path: "/tmp/latr.lock"}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "file:/tmp/latr.lock", lock.Describe())
+
+	_, err = New(config.LeaderElectionConfig{Backend: config.LeaderElectionKubernetes, Path: "latr-leader"}, nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no kubernetes client is available")
+}
+
+func TestNewLocker(t *testing.T) {
+	token := config.TokenConfig{
+		Label:   "Prod_API/Token",
+		Storage: []config.StorageConfig{{Type: "vault", Path: "linode/tokens/prod"}},
+	}
+
+	locker, err := NewLocker(config.TokenLockConfig{Backend: config.LeaderElectionVault}, fakeVaultClient{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "vault:linode/tokens/prod.latr-lock", locker(token).Describe())
+
+	locker, err = NewLocker(config.TokenLockConfig{Backend: config.LeaderElectionFile, Path: "/var/lock/latr"}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "file:/var/lock/latr/Prod_API_Token.lock", locker(token).Describe())
+
+	// The same label may be used in another account
+	token.Account = "staging"
+	assert.Equal(t, "file:/var/lock/latr/staging-Prod_API_Token.lock", locker(token).Describe())
+
+	_, err = NewLocker(config.TokenLockConfig{Backend: config.LeaderElectionKubernetes}, nil, nil)
+	require.Error(t, err)
+}
+
+func TestLeaseName(t *testing.T) {
+	assert.Equal(t, "latr-token-prod-api-token", leaseName("latr-token", "Prod_API Token"))
+	assert.Equal(t, "latr-token-prod.api", leaseName("latr-token", "prod.api."))
+	assert.Len(t, leaseName("latr-token", strings.Repeat("a", 300)), maxLeaseName)
+}
@@ -0,0 +1,72 @@
+package leader
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/wbh1/latr/internal/config"
+)
+
+// lockSuffix is appended to a token's first storage path to name its Vault lock
+const lockSuffix = ".latr-lock"
+
+// maxLeaseName is the longest valid Lease name (a DNS subdomain)
+const maxLeaseName = 253
+
+var invalidLeaseChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// Locker returns the lock guarding a single token
+type Locker func(token config.TokenConfig) Lock
+
+// NewLocker creates per-token locks for a token lock configuration
+//
+// Vault locks are kept next to the token state at "<path>.latr-lock", so the
+// caller must make requests in the state's namespace and mount. Leases are named
+// "<path>-<label>", and lock files "<label>.lock" inside the path directory. Labels
+// of tokens in named accounts are prefixed with "<account>-", since the same label
+// may be used in several accounts.
+// vaultClient and kubeClient may be nil if the backend doesn't use them.
+func NewLocker(cfg config.TokenLockConfig, vaultClient VaultClient, kubeClient KubernetesClient) (Locker, error) {
+	switch cfg.Backend {
+	case "", config.LeaderElectionVault:
+		if vaultClient == nil {
+			return nil, fmt.Errorf("no vault client is available")
+		}
+		return func(token config.TokenConfig) Lock {
+			return NewVault(vaultClient, token.Storage[0].Path+lockSuffix)
+		}, nil
+	case config.LeaderElectionKubernetes:
+		if kubeClient == nil {
+			return nil, fmt.Errorf("no kubernetes client is available")
+		}
+		return func(token config.TokenConfig) Lock {
+			return NewKubernetes(kubeClient, cfg.Namespace, leaseName(cfg.Path, lockLabel(token)))
+		}, nil
+	case config.LeaderElectionFile:
+		return func(token config.TokenConfig) Lock {
+			name := strings.NewReplacer("/", "_", `\`, "_").Replace(lockLabel(token))
+			return NewFile(filepath.Join(cfg.Path, name+".lock"))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported token lock backend %q", cfg.Backend)
+	}
+}
+
+// lockLabel returns the token's label, prefixed with its account unless it's in the default one
+func lockLabel(token config.TokenConfig) string {
+	if account := token.AccountName(); account != config.DefaultAccount {
+		return account + "-" + token.Label
+	}
+	return token.Label
+}
+
+// leaseName builds a valid Lease name from prefix and a token label
+func leaseName(prefix, label string) string {
+	name := invalidLeaseChars.ReplaceAllString(strings.ToLower(prefix+"-"+label), "-")
+	if len(name) > maxLeaseName {
+		name = name[:maxLeaseName]
+	}
+	return strings.Trim(name, "-.")
+}
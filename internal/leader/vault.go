@@ -0,0 +1,42 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// VaultClient defines the Vault operations used by the Vault lock
+type VaultClient interface {
+	TryAcquireLock(ctx context.Context, path, holder string, ttl time.Duration) (bool, error)
+	ReleaseLock(ctx context.Context, path, holder string) error
+}
+
+// Vault is a lock stored in a KV v2 secret
+type Vault struct {
+	client VaultClient
+	path   string
+}
+
+// NewVault creates a lock stored at path in the client's KV mount
+func NewVault(client VaultClient, path string) *Vault {
+	return &Vault{
+		client: client,
+		path:   path,
+	}
+}
+
+// TryAcquire takes or renews the lock
+func (v *Vault) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	return v.client.TryAcquireLock(ctx, v.path, holder, ttl)
+}
+
+// Release gives up the lock
+func (v *Vault) Release(ctx context.Context, holder string) error {
+	return v.client.ReleaseLock(ctx, v.path, holder)
+}
+
+// Describe returns the Vault path of the lock
+func (v *Vault) Describe() string {
+	return fmt.Sprintf("vault:%s", v.path)
+}
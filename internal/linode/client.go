@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/linode/linodego"
@@ -12,32 +13,114 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// TokenSource reads the token the client authenticates with
+type TokenSource func(ctx context.Context) (string, error)
+
 // Client wraps the linodego client
 type Client struct {
-	client *linodego.Client
-	token  string
+	mu      sync.RWMutex
+	client  *linodego.Client
+	token   string
+	baseURL string
+	retry   RetryPolicy
+	source  TokenSource
 }
 
 // NewClient creates a new Linode API client
 func NewClient(token string) *Client {
+	return &Client{
+		client: newLinodeClient(token, ""),
+		token:  token,
+		retry:  DefaultRetryPolicy(),
+	}
+}
+
+// SetToken replaces the token the client authenticates with
+// Requests already in flight finish with the previous token.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client = newLinodeClient(token, c.baseURL)
+	c.token = token
+}
+
+// SetBaseURL points the client at another API, e.g. "https://api.dev.linode.com"
+// The API version is appended to it. An empty URL uses the public API, or
+// LINODE_API_URL if it is set.
+func (c *Client) SetBaseURL(baseURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client = newLinodeClient(c.token, baseURL)
+	c.baseURL = baseURL
+}
+
+// SetTokenSource sets where RefreshToken reads the token from
+func (c *Client) SetTokenSource(source TokenSource) {
+	c.source = source
+}
+
+// RefreshToken reads the token from the client's source and switches to it if it changed
+// The current token is kept if the source can't be read.
+func (c *Client) RefreshToken(ctx context.Context) error {
+	if c.source == nil {
+		return nil
+	}
+
+	token, err := c.source(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read Linode token: %w", err)
+	}
+	if token == "" {
+		return fmt.Errorf("failed to read Linode token: token is empty")
+	}
+
+	c.mu.RLock()
+	unchanged := token == c.token
+	c.mu.RUnlock()
+	if !unchanged {
+		c.SetToken(token)
+	}
+	return nil
+}
+
+// api returns the linodego client for the current token
+func (c *Client) api() *linodego.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// newClientFor returns a linodego client for the same API that authenticates with token
+func (c *Client) newClientFor(token string) *linodego.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return newLinodeClient(token, c.baseURL)
+}
+
+// newLinodeClient returns a linodego client for the API at baseURL that authenticates with token
+func newLinodeClient(token, baseURL string) *linodego.Client {
 	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
 	oauth2Client := oauth2.NewClient(context.Background(), tokenSource)
 
 	linodeClient := linodego.NewClient(oauth2Client)
+	// Retries are handled by Client, which knows which requests are safe to repeat
+	linodeClient.SetRetryCount(0)
 
 	// Support base URL override for testing
-	baseURL := os.Getenv("LINODE_API_URL")
+	if baseURL == "" {
+		baseURL = os.Getenv("LINODE_API_URL")
+	}
 	if baseURL != "" {
 		linodeClient.SetBaseURL(baseURL)
 	}
 
-	return &Client{
-		client: &linodeClient,
-		token:  token,
-	}
+	return &linodeClient
 }
 
 // CreateToken creates a new Linode API token
+// A create that fails without a clear answer from the API (a server or network error)
+// may still have made the token. Before trying again, tokens with the same label and
+// expiry created since the request are revoked, so retries never leave duplicates.
 func (c *Client) CreateToken(ctx context.Context, label, scopes string, expiry time.Time) (*models.Token, error) {
 	createOpts := linodego.TokenCreateOptions{
 		Label:  label,
@@ -45,48 +128,44 @@ func (c *Client) CreateToken(ctx context.Context, label, scopes string, expiry t
 		Expiry: &expiry,
 	}
 
-	token, err := c.client.CreateToken(ctx, createOpts)
+	var token *linodego.Token
+	err := c.do(ctx, "create token", func() error {
+		requestedAt := time.Now()
+		created, err := c.api().CreateToken(ctx, createOpts)
+		if err == nil {
+			token = created
+			return nil
+		}
+		if !mayHaveSucceeded(err) {
+			return err
+		}
+		if cleanupErr := c.removeOrphanedTokens(ctx, label, expiry, requestedAt); cleanupErr != nil {
+			// Creating again could leave a duplicate behind
+			return &permanentError{err: fmt.Errorf("%w (checking for a token it may have created failed: %v)", err, cleanupErr)}
+		}
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create token: %w", err)
 	}
 
-	return &models.Token{
-		ID:        token.ID,
-		Label:     token.Label,
-		Token:     token.Token,
-		CreatedAt: *token.Created,
-		ExpiresAt: *token.Expiry,
-		Scopes:    token.Scopes,
-		Validity:  time.Until(*token.Expiry),
-	}, nil
+	result := tokenFromAPI(token)
+	result.Token = token.Token
+	return result, nil
 }
 
 // GetToken retrieves a token by ID
 func (c *Client) GetToken(ctx context.Context, tokenID int) (*models.Token, error) {
-	token, err := c.client.GetToken(ctx, tokenID)
+	var token *linodego.Token
+	err := c.do(ctx, "get token", func() (err error) {
+		token, err = c.api().GetToken(ctx, tokenID)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get token: %w", err)
 	}
 
-	created := time.Now()
-	if token.Created != nil {
-		created = *token.Created
-	}
-
-	expiry := time.Now().Add(90 * 24 * time.Hour)
-	if token.Expiry != nil {
-		expiry = *token.Expiry
-	}
-
-	return &models.Token{
-		ID:        token.ID,
-		Label:     token.Label,
-		Token:     "", // The API doesn't return the token value for existing tokens
-		CreatedAt: created,
-		ExpiresAt: expiry,
-		Scopes:    token.Scopes,
-		Validity:  expiry.Sub(created),
-	}, nil
+	return tokenFromAPI(token), nil
 }
 
 // FindTokenByLabel finds a token by its label
@@ -101,35 +180,46 @@ func (c *Client) FindTokenByLabel(ctx context.Context, label string) ([]*models.
 	}
 	opts := linodego.NewListOptions(0, string(filterStr))
 
-	tokens, err := c.client.ListTokens(ctx, opts)
+	var tokens []linodego.Token
+	err = c.do(ctx, "list tokens", func() (err error) {
+		tokens, err = c.api().ListTokens(ctx, opts)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list tokens: %w", err)
 	}
 
 	var result []*models.Token
-	for _, token := range tokens {
-		created := time.Now()
-		if token.Created != nil {
-			created = *token.Created
-		}
+	for i := range tokens {
+		result = append(result, tokenFromAPI(&tokens[i]))
+	}
 
-		expiry := time.Now().Add(90 * 24 * time.Hour)
-		if token.Expiry != nil {
-			expiry = *token.Expiry
-		}
+	return result, nil
+}
 
-		result = append(result, &models.Token{
-			ID:        token.ID,
-			Label:     token.Label,
-			Token:     "", // The API doesn't return the token value for existing tokens
-			CreatedAt: created,
-			ExpiresAt: expiry,
-			Scopes:    token.Scopes,
-			Validity:  expiry.Sub(created),
-		})
+// tokenFromAPI converts a token returned by the API
+// The value is only returned when a token is created, so it's left empty. A token
+// without an expiry never expires and has no validity period.
+func tokenFromAPI(token *linodego.Token) *models.Token {
+	created := time.Now()
+	if token.Created != nil {
+		created = *token.Created
 	}
 
-	return result, nil
+	result := &models.Token{
+		ID:        token.ID,
+		Label:     token.Label,
+		CreatedAt: created,
+		Scopes:    token.Scopes,
+	}
+	if token.Expiry == nil {
+		result.NeverExpires = true
+	} else {
+		result.ExpiresAt = *token.Expiry
+		result.Validity = token.Expiry.Sub(created)
+	}
+
+	return result
 }
 
 // UpdateToken updates a token's expiry (if supported by the API)
@@ -139,28 +229,37 @@ func (c *Client) UpdateToken(ctx context.Context, tokenID int, expiry time.Time)
 		Label: "", // Keep existing label
 	}
 
-	_, err := c.client.UpdateToken(ctx, tokenID, updateOpts)
+	err := c.do(ctx, "update token", func() error {
+		_, err := c.api().UpdateToken(ctx, tokenID, updateOpts)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to update token: %w", err)
 	}
 	return nil
 }
 
+// DeleteToken revokes a token by ID
+// A token that no longer exists is treated as already deleted
+func (c *Client) DeleteToken(ctx context.Context, tokenID int) error {
+	err := c.do(ctx, "delete token", func() error {
+		return c.api().DeleteToken(ctx, tokenID)
+	})
+	if err != nil {
+		if IsNotFoundError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	return nil
+}
+
 // IsNotFoundError checks if an error is a 404 not found error
 func IsNotFoundError(err error) bool {
 	if err == nil {
 		return false
 	}
 
-	if apiErr, ok := err.(*linodego.Error); ok {
-		return apiErr.Code == http.StatusNotFound
-	}
-
-	return false
-}
-
-// ParseScopes parses and returns the scopes string
-// This is a simple pass-through for now, but could be enhanced to validate scopes
-func ParseScopes(scopes string) string {
-	return scopes
+	status, ok := statusCode(err)
+	return ok && status == http.StatusNotFound
 }
@@ -2,9 +2,12 @@ package linode
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/linode/linodego"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -44,7 +47,7 @@ func TestParseTokenScopes(t *testing.T) {
 		{
 			name:     "specific scopes",
 			scopes:   "linodes:read_only,domains:read_only",
-			expected: "linodes:read_only,domains:read_only",
+			expected: "domains:read_only,linodes:read_only",
 		},
 		{
 			name:     "single scope",
@@ -55,8 +58,69 @@ func TestParseTokenScopes(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := ParseScopes(tt.scopes)
-			assert.Equal(t, tt.expected, result)
+			result, err := ParseScopes(tt.scopes)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.String())
 		})
 	}
 }
+
+func TestTokenFromAPI(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	expiry := created.Add(90 * 24 * time.Hour)
+
+	token := tokenFromAPI(&linodego.Token{ID: 1, Label: "expiring", Created: &created, Expiry: &expiry})
+	assert.False(t, token.NeverExpires)
+	assert.Equal(t, expiry, token.ExpiresAt)
+	assert.Equal(t, 90*24*time.Hour, token.Validity)
+
+	// Tokens created without an expiry are reported as such instead of with a made-up one
+	token = tokenFromAPI(&linodego.Token{ID: 2, Label: "manual", Created: &created})
+	assert.True(t, token.NeverExpires)
+	assert.True(t, token.ExpiresAt.IsZero())
+	assert.Zero(t, token.Validity)
+}
+
+func TestSetToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [], "page": 1, "pages": 1, "results": 0}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("LINODE_API_URL", server.URL)
+
+	client := NewClient("old-token")
+	_, err := client.FindTokenByLabel(context.Background(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer old-token", authorization)
+
+	client.SetToken("new-token")
+	_, err = client.FindTokenByLabel(context.Background(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer new-token", authorization)
+}
+
+func TestSetBaseURL(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [], "page": 1, "pages": 1, "results": 0}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("LINODE_API_URL", "http://127.0.0.1:1")
+
+	client := NewClient("account-token")
+	client.SetBaseURL(server.URL)
+	_, err := client.FindTokenByLabel(context.Background(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer account-token", authorization)
+
+	// Switching tokens keeps the account's API
+	client.SetToken("new-token")
+	_, err = client.FindTokenByLabel(context.Background(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer new-token", authorization)
+}
@@ -0,0 +1,206 @@
+package linode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/linode/linodego"
+	"github.com/wbh1/latr/internal/observability"
+)
+
+// RetryPolicy controls how Linode API requests are retried after rate limits (429),
+// server errors (5xx) and network errors
+type RetryPolicy struct {
+	MaxAttempts    int           // Attempts per request, including the first
+	InitialBackoff time.Duration // Wait before the first retry, doubled for each retry after it
+	MaxBackoff     time.Duration // Longest wait between attempts, unless Retry-After asks for more
+}
+
+// DefaultRetryPolicy returns the policy clients use unless SetRetryPolicy is called
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+	}
+}
+
+// SetRetryPolicy sets how failed requests are retried
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = policy
+}
+
+// backoff returns how long to wait after the given failed attempt
+// The exponential backoff is jittered so that replicas don't retry in lockstep, and
+// a Retry-After from the API takes precedence if it asks for a longer wait. Retry-After
+// is still capped at MaxBackoff, so a misbehaving API can't stall a cycle for hours.
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if wait > 0 {
+		wait = wait/2 + rand.N(wait/2+1)
+	}
+	if p.MaxBackoff > 0 && retryAfter > p.MaxBackoff {
+		retryAfter = p.MaxBackoff
+	}
+	return max(wait, retryAfter)
+}
+
+// permanentError marks an error that must not be retried even though its cause could be
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// do calls fn until it succeeds, fails with an error that isn't worth retrying, the
+// policy's attempts run out or ctx is done
+func (c *Client) do(ctx context.Context, operation string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isRetryable(err) || attempt >= c.retry.MaxAttempts {
+			return err
+		}
+
+		wait := c.retry.backoff(attempt, retryAfter(err))
+		attrs := append([]any{
+			slog.String("operation", operation),
+			slog.Int("attempt", attempt),
+			slog.Duration("wait", wait),
+			slog.Any("error", err),
+		}, observability.TraceAttrs(ctx)...)
+		observability.GetLogger().WarnContext(ctx, "Linode API request failed, retrying", attrs...)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryable reports whether a failed request may succeed if it is sent again
+func isRetryable(err error) bool {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	status, ok := statusCode(err)
+	if !ok {
+		return false
+	}
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	// linodego reports errors raised before a response was read (connection resets,
+	// timeouts) with codes below 100
+	return status < 100
+}
+
+// mayHaveSucceeded reports whether a retryable error leaves it unknown if the API
+// carried out the request
+// A rate-limited request was rejected before it was handled, anything else may have
+// been handled even though the response never made it back.
+func mayHaveSucceeded(err error) bool {
+	status, _ := statusCode(err)
+	return isRetryable(err) && status != http.StatusTooManyRequests
+}
+
+// statusCode returns the HTTP status of a linodego error, or the code linodego uses for
+// errors raised before a response was read
+// linodego returns its Error both by pointer and by value.
+func statusCode(err error) (int, bool) {
+	if apiErr, ok := linodeError(err); ok {
+		return apiErr.Code, true
+	}
+	return 0, false
+}
+
+// linodeError unwraps a linodego error, whether it was returned by pointer or by value
+func linodeError(err error) (*linodego.Error, bool) {
+	var ptr *linodego.Error
+	if errors.As(err, &ptr) && ptr != nil {
+		return ptr, true
+	}
+	var val linodego.Error
+	if errors.As(err, &val) {
+		return &val, true
+	}
+	return nil, false
+}
+
+// retryAfter returns the wait a response asked for with its Retry-After header, in
+// seconds or as an HTTP date
+func retryAfter(err error) time.Duration {
+	apiErr, ok := linodeError(err)
+	if !ok || apiErr.Response == nil {
+		return 0
+	}
+
+	header := apiErr.Response.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// creationClockSkew is how much earlier than the request an orphaned token may appear to
+// have been created, to allow for clock differences between latr and the API
+const creationClockSkew = time.Minute
+
+// removeOrphanedTokens revokes tokens that a create request may have made even though it
+// failed, matching them by label, creation time and expiry
+// The value of such a token was never returned, so it can't be used and is revoked
+// before creating again, instead of leaving a duplicate behind.
+func (c *Client) removeOrphanedTokens(ctx context.Context, label string, expiry, requestedAt time.Time) error {
+	tokens, err := c.FindTokenByLabel(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if token.CreatedAt.Before(requestedAt.Add(-creationClockSkew)) {
+			continue
+		}
+		// Expiries are sent with second precision
+		if diff := token.ExpiresAt.Sub(expiry); diff < -time.Second || diff > time.Second {
+			continue
+		}
+
+		attrs := append([]any{
+			slog.String("token_label", label),
+			slog.Int("token_id", token.ID),
+		}, observability.TraceAttrs(ctx)...)
+		observability.GetLogger().WarnContext(ctx, "Revoking token left behind by a failed create request", attrs...)
+
+		if err := c.DeleteToken(ctx, token.ID); err != nil {
+			return fmt.Errorf("failed to revoke token %d: %w", token.ID, err)
+		}
+	}
+
+	return nil
+}
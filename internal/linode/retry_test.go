@@ -0,0 +1,237 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenServer is a Linode API server for profile tokens whose responses can be failed
+type tokenServer struct {
+	mu      sync.Mutex
+	tokens  map[int]map[string]interface{}
+	nextID  int
+	creates int
+	deleted []int
+	// fail returns a status to fail a request with before it is handled, or 0
+	fail func(r *http.Request) int
+	// failAfterCreate returns a status to fail a create with after the token was made, or 0
+	failAfterCreate func() int
+}
+
+// newTokenServer starts a tokenServer and points clients at it
+func newTokenServer(t *testing.T) *tokenServer {
+	t.Helper()
+
+	ts := &tokenServer{tokens: make(map[int]map[string]interface{}), nextID: 1}
+	server := httptest.NewServer(http.HandlerFunc(ts.handle))
+	t.Cleanup(server.Close)
+	t.Setenv("LINODE_API_URL", server.URL)
+
+	return ts
+}
+
+func (ts *tokenServer) handle(w http.ResponseWriter, r *http.Request) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if ts.fail != nil {
+		if status := ts.fail(r); status != 0 {
+			writeAPIError(w, status)
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v4/profile/tokens":
+		var opts map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&opts)
+		ts.creates++
+		token := map[string]interface{}{
+			"id":      ts.nextID,
+			"label":   opts["label"],
+			"scopes":  opts["scopes"],
+			"expiry":  opts["expiry"],
+			"created": time.Now().UTC().Format("2006-01-02T15:04:05"),
+			"token":   "secret",
+		}
+		ts.tokens[ts.nextID] = token
+		ts.nextID++
+		if ts.failAfterCreate != nil {
+			if status := ts.failAfterCreate(); status != 0 {
+				writeAPIError(w, status)
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(token)
+	case r.Method == http.MethodGet && r.URL.Path == "/v4/profile/tokens":
+		var filter map[string]string
+		json.Unmarshal([]byte(r.Header.Get("X-Filter")), &filter)
+		data := []interface{}{}
+		for _, token := range ts.tokens {
+			if token["label"] == filter["label"] {
+				data = append(data, token)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "page": 1, "pages": 1, "results": len(data)})
+	case r.Method == http.MethodDelete:
+		var id int
+		json.Unmarshal([]byte(r.URL.Path[len("/v4/profile/tokens/"):]), &id)
+		delete(ts.tokens, id)
+		ts.deleted = append(ts.deleted, id)
+		json.NewEncoder(w).Encode(map[string]interface{}{})
+	default:
+		writeAPIError(w, http.StatusNotFound)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"reason": http.StatusText(status)}},
+	})
+}
+
+// fastRetries keeps tests from waiting on backoffs
+var fastRetries = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestRetry_RateLimit(t *testing.T) {
+	ts := newTokenServer(t)
+	attempts := 0
+	ts.fail = func(r *http.Request) int {
+		attempts++
+		if attempts == 1 {
+			return http.StatusTooManyRequests
+		}
+		return 0
+	}
+
+	client := NewClient("admin-token")
+	client.SetRetryPolicy(fastRetries)
+
+	token, err := client.CreateToken(context.Background(), "test", "*", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", token.Token)
+
+	// A rate-limited create was never handled, so there is nothing to look up
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 1, ts.creates)
+}
+
+func TestRetry_GivesUp(t *testing.T) {
+	ts := newTokenServer(t)
+	ts.fail = func(r *http.Request) int { return http.StatusServiceUnavailable }
+
+	client := NewClient("admin-token")
+	client.SetRetryPolicy(fastRetries)
+
+	_, err := client.FindTokenByLabel(context.Background(), "test")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "[503]")
+
+	// Client errors aren't retried
+	attempts := 0
+	ts.fail = func(r *http.Request) int {
+		attempts++
+		return http.StatusBadRequest
+	}
+	_, err = client.FindTokenByLabel(context.Background(), "test")
+	require.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetry_StopsWaitingWhenCancelled(t *testing.T) {
+	ts := newTokenServer(t)
+	ts.fail = func(r *http.Request) int { return http.StatusTooManyRequests }
+
+	client := NewClient("admin-token")
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.FindTokenByLabel(ctx, "test")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "[429]")
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestCreateToken_RevokesTokenFromAmbiguousFailure(t *testing.T) {
+	ts := newTokenServer(t)
+	ts.failAfterCreate = func() int {
+		if ts.creates == 1 {
+			return http.StatusGatewayTimeout
+		}
+		return 0
+	}
+
+	client := NewClient("admin-token")
+	client.SetRetryPolicy(fastRetries)
+
+	// A token with the same label from an earlier rotation is left alone
+	ts.tokens[99] = map[string]interface{}{
+		"id": 99, "label": "test", "scopes": "*",
+		"created": "2020-01-01T00:00:00", "expiry": "2020-04-01T00:00:00",
+	}
+
+	token, err := client.CreateToken(context.Background(), "test", "*", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, ts.creates)
+	assert.Equal(t, []int{1}, ts.deleted)
+	assert.Equal(t, 2, token.ID)
+	assert.Len(t, ts.tokens, 2)
+}
+
+func TestCreateToken_StopsWhenLookupFails(t *testing.T) {
+	ts := newTokenServer(t)
+	ts.failAfterCreate = func() int { return http.StatusInternalServerError }
+	ts.fail = func(r *http.Request) int {
+		if r.Method == http.MethodGet {
+			return http.StatusForbidden
+		}
+		return 0
+	}
+
+	client := NewClient("admin-token")
+	client.SetRetryPolicy(fastRetries)
+
+	_, err := client.CreateToken(context.Background(), "test", "*", time.Now().Add(time.Hour))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checking for a token it may have created failed")
+
+	// Creating again could have left a second token behind
+	assert.Equal(t, 1, ts.creates)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 4 * time.Second}
+
+	for attempt, ceiling := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 4 * time.Second} {
+		wait := policy.backoff(attempt, 0)
+		assert.GreaterOrEqual(t, wait, ceiling/2)
+		assert.LessOrEqual(t, wait, ceiling)
+	}
+
+	// Retry-After wins when it asks for longer, up to MaxBackoff
+	assert.Equal(t, 3*time.Second, policy.backoff(1, 3*time.Second))
+	assert.Equal(t, 4*time.Second, policy.backoff(1, time.Hour))
+
+	rateLimited := &linodego.Error{
+		Code:     http.StatusTooManyRequests,
+		Response: &http.Response{Header: http.Header{"Retry-After": []string{"120"}}},
+	}
+	assert.Equal(t, 2*time.Minute, retryAfter(fmt.Errorf("failed to list tokens: %w", rateLimited)))
+	assert.Equal(t, time.Duration(0), retryAfter(linodego.Error{Code: http.StatusBadGateway}))
+}
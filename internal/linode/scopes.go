@@ -0,0 +1,240 @@
+package linode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AccessLevel is the access a scope grants to a resource
+// read_write includes read_only, so levels are ordered.
+type AccessLevel int
+
+// Access levels of an OAuth scope
+const (
+	ReadOnly AccessLevel = iota + 1
+	ReadWrite
+)
+
+// String returns the level as it appears in a scope, e.g. "read_only"
+func (l AccessLevel) String() string {
+	switch l {
+	case ReadOnly:
+		return "read_only"
+	case ReadWrite:
+		return "read_write"
+	default:
+		return fmt.Sprintf("AccessLevel(%d)", int(l))
+	}
+}
+
+// parseAccessLevel parses the level of a scope
+func parseAccessLevel(level string) (AccessLevel, bool) {
+	switch level {
+	case "read_only":
+		return ReadOnly, true
+	case "read_write":
+		return ReadWrite, true
+	default:
+		return 0, false
+	}
+}
+
+// Resources that OAuth scopes can grant access to
+var Resources = []string{
+	"account",
+	"child_account",
+	"databases",
+	"domains",
+	"events",
+	"firewall",
+	"images",
+	"ips",
+	"linodes",
+	"lke",
+	"longview",
+	"maintenance",
+	"monitor",
+	"nodebalancers",
+	"object_storage",
+	"stackscripts",
+	"volumes",
+	"vpc",
+}
+
+// knownResources indexes Resources
+var knownResources = func() map[string]bool {
+	known := make(map[string]bool, len(Resources))
+	for _, resource := range Resources {
+		known[resource] = true
+	}
+	return known
+}()
+
+// Scopes is a set of OAuth scopes, such as "linodes:read_only,domains:read_write" or "*"
+// The zero value grants nothing.
+type Scopes struct {
+	all    bool
+	levels map[string]AccessLevel
+}
+
+// AllScopes returns the wildcard scope, read_write access to everything
+func AllScopes() Scopes {
+	return Scopes{all: true}
+}
+
+// ParseScopes parses a scopes string
+// Scopes are separated by commas or spaces and have the form resource:level, or are the
+// wildcard "*". Unknown resources and levels are rejected, so typos are caught before a
+// token is created with them. A resource listed more than once gets its highest level.
+func ParseScopes(scopes string) (Scopes, error) {
+	var parsed Scopes
+	fields := splitScopes(scopes)
+	if len(fields) == 0 {
+		return parsed, fmt.Errorf("no scopes given")
+	}
+
+	for _, scope := range fields {
+		if scope == "*" {
+			parsed.all = true
+			continue
+		}
+
+		resource, levelName, ok := strings.Cut(scope, ":")
+		if !ok {
+			return Scopes{}, fmt.Errorf("invalid scope %q (expected resource:read_only or resource:read_write)", scope)
+		}
+		if !knownResources[resource] {
+			return Scopes{}, fmt.Errorf("unknown resource %q in scope %q", resource, scope)
+		}
+		level, ok := parseAccessLevel(levelName)
+		if !ok {
+			return Scopes{}, fmt.Errorf("unknown access level %q in scope %q (expected read_only or read_write)", levelName, scope)
+		}
+
+		if parsed.levels == nil {
+			parsed.levels = make(map[string]AccessLevel)
+		}
+		if level > parsed.levels[resource] {
+			parsed.levels[resource] = level
+		}
+	}
+
+	if parsed.all {
+		return AllScopes(), nil
+	}
+	return parsed, nil
+}
+
+// splitScopes splits a scopes string on the commas and spaces that may separate scopes
+func splitScopes(scopes string) []string {
+	return strings.FieldsFunc(scopes, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// All reports whether s is the wildcard scope
+func (s Scopes) All() bool {
+	return s.all
+}
+
+// Level returns the access s grants to resource, or 0 if it grants none
+func (s Scopes) Level(resource string) AccessLevel {
+	if s.all {
+		return ReadWrite
+	}
+	return s.levels[resource]
+}
+
+// Allows reports whether s grants at least level access to resource
+func (s Scopes) Allows(resource string, level AccessLevel) bool {
+	return s.Level(resource) >= level
+}
+
+// Resources returns the resources s grants access to, sorted
+// The wildcard grants every resource.
+func (s Scopes) Resources() []string {
+	if s.all {
+		return append([]string(nil), Resources...)
+	}
+	resources := make([]string, 0, len(s.levels))
+	for resource := range s.levels {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// IsSubsetOf reports whether other grants everything s grants
+func (s Scopes) IsSubsetOf(other Scopes) bool {
+	if other.all {
+		return true
+	}
+	if s.all {
+		return false
+	}
+	for resource, level := range s.levels {
+		if !other.Allows(resource, level) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether s and other grant the same access
+func (s Scopes) Equal(other Scopes) bool {
+	return s.IsSubsetOf(other) && other.IsSubsetOf(s)
+}
+
+// Union returns the scopes granting everything either s or other grants
+func (s Scopes) Union(other Scopes) Scopes {
+	if s.all || other.all {
+		return AllScopes()
+	}
+	union := Scopes{levels: make(map[string]AccessLevel, len(s.levels)+len(other.levels))}
+	for _, levels := range []map[string]AccessLevel{s.levels, other.levels} {
+		for resource, level := range levels {
+			if level > union.levels[resource] {
+				union.levels[resource] = level
+			}
+		}
+	}
+	return union
+}
+
+// String returns s in the canonical form accepted by the Linode API: "*", or the scopes
+// sorted by resource and separated by commas
+func (s Scopes) String() string {
+	if s.all {
+		return "*"
+	}
+	resources := s.Resources()
+	scopes := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		scopes = append(scopes, resource+":"+s.levels[resource].String())
+	}
+	return strings.Join(scopes, ",")
+}
+
+// NormalizeScopes returns scopes sorted, deduplicated and comma-separated, so that
+// scopes strings can be compared regardless of order and spacing
+// Strings that don't parse, e.g. with resources this version doesn't know, are
+// normalized textually. A wildcard anywhere grants everything and normalizes to "*".
+func NormalizeScopes(scopes string) string {
+	if parsed, err := ParseScopes(scopes); err == nil {
+		return parsed.String()
+	}
+
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, scope := range splitScopes(scopes) {
+		if scope == "*" {
+			return "*"
+		}
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+	sort.Strings(normalized)
+	return strings.Join(normalized, ",")
+}
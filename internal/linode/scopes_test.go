@@ -0,0 +1,91 @@
+package linode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   string
+		expected string
+	}{
+		{name: "wildcard", scopes: "*", expected: "*"},
+		{name: "wildcard among others", scopes: "linodes:read_only *", expected: "*"},
+		{name: "sorted", scopes: "linodes:read_only,domains:read_only", expected: "domains:read_only,linodes:read_only"},
+		{name: "spaces and duplicates", scopes: " linodes:read_only, domains:read_only linodes:read_only ", expected: "domains:read_only,linodes:read_only"},
+		{name: "redundant levels", scopes: "linodes:read_only,linodes:read_write", expected: "linodes:read_write"},
+		{name: "unknown resource", scopes: "widgets:read_only, linodes:read_only", expected: "linodes:read_only,widgets:read_only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NormalizeScopes(tt.scopes))
+		})
+	}
+}
+
+func TestParseScopes_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  string
+		message string
+	}{
+		{name: "empty", scopes: " , ", message: "no scopes given"},
+		{name: "missing level", scopes: "linodes", message: `invalid scope "linodes"`},
+		{name: "unknown resource", scopes: "linode:read_only", message: `unknown resource "linode"`},
+		{name: "unknown level", scopes: "domains:read", message: `unknown access level "read"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScopes(tt.scopes)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
+
+func TestScopes_Levels(t *testing.T) {
+	scopes, err := ParseScopes("linodes:read_only domains:read_write linodes:read_write")
+	require.NoError(t, err)
+
+	assert.Equal(t, "domains:read_write,linodes:read_write", scopes.String())
+	assert.Equal(t, []string{"domains", "linodes"}, scopes.Resources())
+	assert.True(t, scopes.Allows("linodes", ReadOnly))
+	assert.True(t, scopes.Allows("linodes", ReadWrite))
+	assert.False(t, scopes.Allows("volumes", ReadOnly))
+	assert.False(t, scopes.All())
+
+	assert.True(t, AllScopes().Allows("volumes", ReadWrite))
+	assert.Equal(t, Resources, AllScopes().Resources())
+}
+
+func TestScopes_SetOperations(t *testing.T) {
+	parse := func(s string) Scopes {
+		scopes, err := ParseScopes(s)
+		require.NoError(t, err)
+		return scopes
+	}
+
+	readOnly := parse("linodes:read_only")
+	readWrite := parse("linodes:read_write")
+	domains := parse("domains:read_only")
+
+	assert.True(t, readOnly.IsSubsetOf(readWrite))
+	assert.False(t, readWrite.IsSubsetOf(readOnly))
+	assert.False(t, domains.IsSubsetOf(readWrite))
+	assert.True(t, readWrite.IsSubsetOf(AllScopes()))
+	assert.False(t, AllScopes().IsSubsetOf(readWrite))
+
+	// read_write includes read_only, so listing both is the same as read_write alone
+	assert.True(t, parse("linodes:read_write,linodes:read_only").Equal(readWrite))
+	assert.False(t, readOnly.Equal(readWrite))
+	assert.True(t, parse("*").Equal(AllScopes()))
+
+	assert.Equal(t, "domains:read_only,linodes:read_write", readOnly.Union(readWrite).Union(domains).String())
+	assert.True(t, readOnly.Union(AllScopes()).All())
+}
@@ -0,0 +1,31 @@
+package linode
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileTokenSource reads the token from a file, such as a mounted secret
+// Surrounding whitespace, like a trailing newline, is ignored.
+func FileTokenSource(path string) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+}
+
+// EnvTokenSource reads the token from an environment variable
+func EnvTokenSource(name string) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		token := os.Getenv(name)
+		if token == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return token, nil
+	}
+}
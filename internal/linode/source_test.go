@@ -0,0 +1,75 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTokenSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("file-token\n"), 0o600))
+
+	token, err := FileTokenSource(path)(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "file-token", token)
+
+	_, err = FileTokenSource(filepath.Join(t.TempDir(), "missing"))(context.Background())
+	assert.Error(t, err)
+}
+
+func TestEnvTokenSource(t *testing.T) {
+	t.Setenv("LATR_TEST_TOKEN", "env-token")
+
+	token, err := EnvTokenSource("LATR_TEST_TOKEN")(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "env-token", token)
+
+	t.Setenv("LATR_TEST_TOKEN", "")
+	_, err = EnvTokenSource("LATR_TEST_TOKEN")(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "LATR_TEST_TOKEN is not set")
+}
+
+func TestRefreshToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [], "page": 1, "pages": 1, "results": 0}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("LINODE_API_URL", server.URL)
+
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("first-token"), 0o600))
+
+	client := NewClient("")
+	client.SetTokenSource(FileTokenSource(path))
+	ctx := context.Background()
+
+	require.NoError(t, client.RefreshToken(ctx))
+	_, err := client.FindTokenByLabel(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer first-token", authorization)
+
+	// The file was replaced, e.g. by a secret update
+	require.NoError(t, os.WriteFile(path, []byte("second-token"), 0o600))
+	require.NoError(t, client.RefreshToken(ctx))
+	_, err = client.FindTokenByLabel(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer second-token", authorization)
+
+	// A source that can't be read leaves the current token in place
+	require.NoError(t, os.Remove(path))
+	require.Error(t, client.RefreshToken(ctx))
+	_, err = client.FindTokenByLabel(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer second-token", authorization)
+}
@@ -0,0 +1,126 @@
+package linode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/linode/linodego"
+	"github.com/wbh1/latr/pkg/models"
+)
+
+// ErrTokenNotAccepted is returned by VerifyToken when the API doesn't accept the token (yet)
+// New tokens can take a moment to propagate, so the check is worth retrying.
+var ErrTokenNotAccepted = errors.New("token was not accepted by the Linode API")
+
+// scopeChecks read a resource that requires a scope, by the scope's resource
+// Scopes whose resources are public (images, stackscripts) can't be checked this way.
+var scopeChecks = map[string]func(ctx context.Context, client *linodego.Client) error{
+	"account": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.GetAccount(ctx)
+		return err
+	},
+	"databases": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListDatabases(ctx, firstPage())
+		return err
+	},
+	"domains": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListDomains(ctx, firstPage())
+		return err
+	},
+	"events": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListEvents(ctx, firstPage())
+		return err
+	},
+	"firewall": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListFirewalls(ctx, firstPage())
+		return err
+	},
+	"ips": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListIPAddresses(ctx, firstPage())
+		return err
+	},
+	"linodes": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListInstances(ctx, firstPage())
+		return err
+	},
+	"lke": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListLKEClusters(ctx, firstPage())
+		return err
+	},
+	"longview": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListLongviewClients(ctx, firstPage())
+		return err
+	},
+	"nodebalancers": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListNodeBalancers(ctx, firstPage())
+		return err
+	},
+	"object_storage": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListObjectStorageBuckets(ctx, firstPage())
+		return err
+	},
+	"volumes": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListVolumes(ctx, firstPage())
+		return err
+	},
+	"vpc": func(ctx context.Context, c *linodego.Client) error {
+		_, err := c.ListVPCs(ctx, firstPage())
+		return err
+	},
+}
+
+// firstPage limits list requests to a single page, since only access is checked
+func firstPage() *linodego.ListOptions {
+	return linodego.NewListOptions(1, "")
+}
+
+// VerifyToken checks that token works by calling the API with it
+// The profile is readable with any valid token, and for each of the token's scopes a
+// resource covered by that scope is read as well. ErrTokenNotAccepted is returned if the
+// token itself is rejected, any other error means it lacks access it should have.
+func (c *Client) VerifyToken(ctx context.Context, token *models.Token) error {
+	client := c.newClientFor(token.Token)
+
+	err := c.do(ctx, "verify token", func() error {
+		_, err := client.GetProfile(ctx)
+		return err
+	})
+	if err != nil {
+		return verifyError("profile", err)
+	}
+
+	// A wildcard token can't lack access, and scopes this version doesn't know can't be checked
+	scopes, err := ParseScopes(token.Scopes)
+	if err != nil || scopes.All() {
+		return nil
+	}
+
+	for _, resource := range scopes.Resources() {
+		check, ok := scopeChecks[resource]
+		if !ok {
+			continue
+		}
+		err := c.do(ctx, "verify token", func() error {
+			return check(ctx, client)
+		})
+		if err != nil {
+			return verifyError(resource, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyError describes a failed verification request for a scope's resource, or "profile"
+func verifyError(resource string, err error) error {
+	var apiErr *linodego.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s", ErrTokenNotAccepted, apiErr.Message)
+	}
+	if resource == "profile" {
+		return fmt.Errorf("failed to read profile with new token: %w", err)
+	}
+	return fmt.Errorf("new token can't access %s resources: %w", resource, err)
+}
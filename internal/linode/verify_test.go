@@ -0,0 +1,68 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wbh1/latr/pkg/models"
+)
+
+// newVerifyServer returns a Linode API server that accepts "valid-token" and only
+// lets it list instances
+func newVerifyServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer valid-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"errors": []map[string]string{{"reason": "Invalid Token"}},
+			})
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v4/profile":
+			json.NewEncoder(w).Encode(map[string]interface{}{"username": "latr"})
+		case "/v4/linode/instances":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": []interface{}{}, "page": 1, "pages": 1, "results": 0})
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"errors": []map[string]string{{"reason": "Unauthorized"}},
+			})
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("LINODE_API_URL", server.URL)
+
+	return server
+}
+
+func TestVerifyToken(t *testing.T) {
+	newVerifyServer(t)
+	client := NewClient("admin-token")
+	ctx := context.Background()
+
+	err := client.VerifyToken(ctx, &models.Token{Token: "valid-token", Scopes: "linodes:read_only,images:read_only"})
+	require.NoError(t, err)
+
+	err = client.VerifyToken(ctx, &models.Token{Token: "valid-token", Scopes: "*"})
+	require.NoError(t, err)
+
+	// The token is valid but can't use one of its scopes
+	err = client.VerifyToken(ctx, &models.Token{Token: "valid-token", Scopes: "linodes:read_only,domains:read_write"})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrTokenNotAccepted)
+	assert.Contains(t, err.Error(), "can't access domains resources")
+
+	err = client.VerifyToken(ctx, &models.Token{Token: "unknown-token", Scopes: "*"})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrTokenNotAccepted)
+}
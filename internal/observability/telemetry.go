@@ -35,10 +35,13 @@ type Config struct {
 
 // Metrics holds all the metric instruments
 type Metrics struct {
-	TokensTotal             metric.Int64Gauge
-	RotationsTotal          metric.Int64Counter
-	RotationDuration        metric.Float64Histogram
-	TokenValidityRemaining  metric.Float64Gauge
+	TokensTotal            metric.Int64Gauge
+	RotationsTotal         metric.Int64Counter
+	RotationDuration       metric.Float64Histogram
+	TokenValidityRemaining metric.Float64Gauge
+	StorageErrorsTotal     metric.Int64Counter
+	// VaultStorageErrorsTotal is the counter StorageErrorsTotal replaced, kept for a release
+	// so that dashboards and alerts can move to the new name
 	VaultStorageErrorsTotal metric.Int64Counter
 }
 
@@ -172,9 +175,17 @@ func createMetrics(meter metric.Meter) (*Metrics, error) {
 		return nil, fmt.Errorf("failed to create token_validity_remaining gauge: %w", err)
 	}
 
+	storageErrorsTotal, err := meter.Int64Counter(
+		"latr_storage_errors_total",
+		metric.WithDescription("Total number of failed writes to storage backends"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage_errors_total counter: %w", err)
+	}
+
 	vaultStorageErrorsTotal, err := meter.Int64Counter(
 		"latr_vault_storage_errors_total",
-		metric.WithDescription("Total number of Vault storage errors"),
+		metric.WithDescription("Total number of Vault storage errors (deprecated, use latr_storage_errors_total)"),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create vault_storage_errors_total counter: %w", err)
@@ -185,6 +196,7 @@ func createMetrics(meter metric.Meter) (*Metrics, error) {
 		RotationsTotal:          rotationsTotal,
 		RotationDuration:        rotationDuration,
 		TokenValidityRemaining:  tokenValidityRemaining,
+		StorageErrorsTotal:      storageErrorsTotal,
 		VaultStorageErrorsTotal: vaultStorageErrorsTotal,
 	}, nil
 }
@@ -224,6 +236,7 @@ func RecordRotation(ctx context.Context, label string, success bool) {
 		metric.WithAttributes(
 			attribute.String("status", status),
 			attribute.String("label", label),
+			attribute.String("account", Account(ctx)),
 		),
 	)
 }
@@ -234,7 +247,10 @@ func RecordRotationDuration(ctx context.Context, label string, duration time.Dur
 		return
 	}
 	globalMetrics.RotationDuration.Record(ctx, duration.Seconds(),
-		metric.WithAttributes(attribute.String("label", label)),
+		metric.WithAttributes(
+			attribute.String("label", label),
+			attribute.String("account", Account(ctx)),
+		),
 	)
 }
 
@@ -244,32 +260,67 @@ func RecordTokenValidityRemaining(ctx context.Context, label string, seconds flo
 		return
 	}
 	globalMetrics.TokenValidityRemaining.Record(ctx, seconds,
-		metric.WithAttributes(attribute.String("label", label)),
+		metric.WithAttributes(
+			attribute.String("label", label),
+			attribute.String("account", Account(ctx)),
+		),
 	)
 }
 
-// RecordVaultStorageError records a Vault storage error
-func RecordVaultStorageError(ctx context.Context, path string) {
+// RecordStorageError records a failed write of a token to a storage backend
+// backend is the backend's description, e.g. "vault:linode/tokens/api". Vault failures
+// are also counted under the deprecated latr_vault_storage_errors_total.
+func RecordStorageError(ctx context.Context, label, storageType, path, backend string) {
 	if globalMetrics == nil {
 		return
 	}
-	globalMetrics.VaultStorageErrorsTotal.Add(ctx, 1,
-		metric.WithAttributes(attribute.String("path", path)),
+	globalMetrics.StorageErrorsTotal.Add(ctx, 1,
+		metric.WithAttributes(
+			attribute.String("label", label),
+			attribute.String("account", Account(ctx)),
+			attribute.String("type", storageType),
+			attribute.String("backend", backend),
+		),
 	)
+	if storageType == "vault" {
+		globalMetrics.VaultStorageErrorsTotal.Add(ctx, 1,
+			metric.WithAttributes(attribute.String("path", path)),
+		)
+	}
+}
+
+// accountKey is the context key of the Linode account a token belongs to
+type accountKey struct{}
+
+// WithAccount returns a context whose logs and metrics are attributed to the named Linode account
+func WithAccount(ctx context.Context, account string) context.Context {
+	return context.WithValue(ctx, accountKey{}, account)
 }
 
-// TraceAttrs extracts OpenTelemetry trace context attributes for structured logging
+// Account returns the Linode account ctx is attributed to, or "" if it isn't
+func Account(ctx context.Context) string {
+	account, _ := ctx.Value(accountKey{}).(string)
+	return account
+}
+
+// TraceAttrs extracts OpenTelemetry trace context attributes for structured logging,
+// along with the Linode account set by WithAccount
 // Returns attributes as []any for use with slog methods
 func TraceAttrs(ctx context.Context) []any {
+	var attrs []any
+	if account := Account(ctx); account != "" {
+		attrs = append(attrs, slog.String("account", account))
+	}
+
 	spanCtx := trace.SpanContextFromContext(ctx)
 	if !spanCtx.IsValid() {
-		return nil
+		return attrs
 	}
 
-	return []any{
+	return append(attrs,
 		slog.String("trace_id", spanCtx.TraceID().String()),
 		slog.String("span_id", spanCtx.SpanID().String()),
-	}
+	)
 }
 
 // SetLogger sets the global logger instance
@@ -0,0 +1,27 @@
+package rotation
+
+import (
+	"github.com/wbh1/latr/internal/config"
+)
+
+// SetAccountClient sets the client that manages the tokens of the named Linode account
+// Tokens of the default account use the client passed to NewEngine.
+func (e *Engine) SetAccountClient(account string, client LinodeClient) {
+	if account == config.DefaultAccount {
+		e.linodeClient = client
+		return
+	}
+	if e.accounts == nil {
+		e.accounts = make(map[string]LinodeClient)
+	}
+	e.accounts[account] = client
+}
+
+// linodeFor returns the client of the Linode account tokenConfig belongs to, or nil if
+// the engine has none
+func (e *Engine) linodeFor(tokenConfig config.TokenConfig) LinodeClient {
+	if account := tokenConfig.AccountName(); account != config.DefaultAccount {
+		return e.accounts[account]
+	}
+	return e.linodeClient
+}
@@ -0,0 +1,94 @@
+package rotation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/wbh1/latr/internal/storage"
+	"github.com/wbh1/latr/pkg/models"
+)
+
+// maxBackendKeyLength keeps backend keys within the key size Vault allows in custom metadata
+const maxBackendKeyLength = 100
+
+// backendKey identifies a storage backend in the token state
+// Descriptions that are too long to be stored as a key are hashed.
+func backendKey(backend storage.Storage) string {
+	key := backend.Describe()
+	if len(key) <= maxBackendKeyLength {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:16])
+}
+
+// delivery records which storage backends, by backendKey, hold a token after it was delivered
+type delivery map[string]bool
+
+// complete reports whether every storage backend holds the token
+// A nil delivery means nothing was written.
+func (d delivery) complete() bool {
+	if d == nil {
+		return false
+	}
+	for _, ok := range d {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// BackendFailure is a storage backend that a token couldn't be written to
+type BackendFailure struct {
+	Backend string // Description of the backend
+	Err     error
+}
+
+// DeliveryError is returned when a token couldn't be written to some of its storage backends
+// The other backends did receive it.
+type DeliveryError struct {
+	Failed []BackendFailure
+	Total  int
+}
+
+func (e *DeliveryError) Error() string {
+	failures := make([]string, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		failures = append(failures, fmt.Sprintf("%s: %v", f.Backend, f.Err))
+	}
+	return fmt.Sprintf("failed to write token to %d of %d storage backends: %s",
+		len(e.Failed), e.Total, strings.Join(failures, "; "))
+}
+
+func (e *DeliveryError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// deliveredBackends returns the token ID each storage backend holds after delivering newToken
+// Backends that are no longer configured are dropped.
+func deliveredBackends(newToken *models.Token, existingState *models.TokenState, d delivery) map[string]int {
+	if d == nil {
+		if existingState == nil {
+			return nil
+		}
+		return existingState.Backends
+	}
+
+	backends := make(map[string]int, len(d))
+	for key, ok := range d {
+		switch {
+		case ok:
+			backends[key] = newToken.ID
+		case existingState != nil && existingState.Backends[key] != 0:
+			backends[key] = existingState.Backends[key]
+		}
+	}
+	return backends
+}
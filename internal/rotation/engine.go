@@ -2,12 +2,17 @@ package rotation
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/linode"
 	"github.com/wbh1/latr/internal/observability"
+	"github.com/wbh1/latr/internal/storage"
+	"github.com/wbh1/latr/internal/vault"
 	"github.com/wbh1/latr/pkg/models"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -17,6 +22,7 @@ import (
 type LinodeClient interface {
 	CreateToken(ctx context.Context, label, scopes string, expiry time.Time) (*models.Token, error)
 	FindTokenByLabel(ctx context.Context, label string) ([]*models.Token, error)
+	DeleteToken(ctx context.Context, tokenID int) error
 }
 
 // VaultClient defines the interface for Vault operations
@@ -30,15 +36,23 @@ type VaultClient interface {
 // Engine handles token rotation logic
 type Engine struct {
 	linodeClient LinodeClient
+	accounts     map[string]LinodeClient // Clients of the named Linode accounts
 	vaultClient  VaultClient
+	storages     *storage.Registry
 	dryRun       bool
+	locks        *TokenLocks
+	verification *Verification
+	selfTokens   map[string]string // Labels of the tokens the Linode clients use, by account
 }
 
 // NewEngine creates a new rotation engine
-func NewEngine(linodeClient LinodeClient, vaultClient VaultClient, dryRun bool) *Engine {
+// linodeClient manages the tokens of the default Linode account, vaultClient is used
+// for token state, storages for delivering tokens
+func NewEngine(linodeClient LinodeClient, vaultClient VaultClient, storages *storage.Registry, dryRun bool) *Engine {
 	return &Engine{
 		linodeClient: linodeClient,
 		vaultClient:  vaultClient,
+		storages:     storages,
 		dryRun:       dryRun,
 	}
 }
@@ -55,14 +69,25 @@ func (e *Engine) ProcessToken(ctx context.Context, tokenConfig config.TokenConfi
 	span.SetAttributes(
 		attribute.String("token.label", tokenConfig.Label),
 		attribute.String("token.team", tokenConfig.Team),
+		attribute.String("token.account", tokenConfig.AccountName()),
 	)
 
+	// Logs and metrics from here on carry the token's account
+	ctx = observability.WithAccount(ctx, tokenConfig.AccountName())
+
 	attrs := append([]any{
 		slog.String("token_label", tokenConfig.Label),
 		slog.String("team", tokenConfig.Team),
 	}, observability.TraceAttrs(ctx)...)
 	logger.InfoContext(ctx, "Processing token", attrs...)
 
+	if e.linodeFor(tokenConfig) == nil {
+		err := fmt.Errorf("no Linode client for account %q of token %s", tokenConfig.AccountName(), tokenConfig.Label)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "unknown account")
+		return err
+	}
+
 	// Parse validity duration
 	validity, err := config.ParseValidityDuration(tokenConfig.Validity)
 	if err != nil {
@@ -71,8 +96,25 @@ func (e *Engine) ProcessToken(ctx context.Context, tokenConfig config.TokenConfi
 		return fmt.Errorf("invalid validity for token %s: %w", tokenConfig.Label, err)
 	}
 
+	// Hold the token's lock from lookup until its state is stored
+	if e.locks != nil && !e.dryRun {
+		lockedCtx, release, acquired, err := e.lockToken(ctx, tokenConfig)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to acquire lock")
+			return err
+		}
+		if !acquired {
+			span.SetAttributes(attribute.Bool("token.locked", true))
+			span.SetStatus(codes.Ok, "locked by another process")
+			return nil
+		}
+		defer release()
+		ctx = lockedCtx
+	}
+
 	// Check if token exists in Linode
-	existingTokens, err := e.linodeClient.FindTokenByLabel(ctx, tokenConfig.Label)
+	existingTokens, err := e.linodeFor(tokenConfig).FindTokenByLabel(ctx, tokenConfig.Label)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to find token")
@@ -94,6 +136,59 @@ func (e *Engine) ProcessToken(ctx context.Context, tokenConfig config.TokenConfi
 		}
 
 	}
+
+	// A token without an expiry never ages, so its policy decides what happens to it
+	if existingToken.NeverExpires {
+		span.SetAttributes(
+			attribute.Bool("token.never_expires", true),
+			attribute.String("token.non_expiring_policy", tokenConfig.OnNonExpiring),
+		)
+		rotate, err := e.checkNonExpiringToken(ctx, tokenConfig, existingToken)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "token never expires")
+			return err
+		}
+		if !rotate {
+			span.SetStatus(codes.Ok, "non-expiring token ignored")
+			return nil
+		}
+		// The adopted token is revoked as a superseded token once its replacement is delivered
+		span.SetAttributes(attribute.String("token.rotation_reason", rotationReasonNonExpiring))
+		return e.rotateToken(ctx, tokenConfig, existingToken, validity)
+	}
+
+	// Finish delivering a token that an earlier run couldn't store
+	needsRotation, err := e.reconcileToken(ctx, tokenConfig, existingToken)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to reconcile token")
+		return fmt.Errorf("failed to reconcile token %s: %w", tokenConfig.Label, err)
+	}
+	if needsRotation {
+		return e.rotateToken(ctx, tokenConfig, existingToken, validity)
+	}
+
+	// Revoke tokens superseded by the current one once their grace period has passed
+	// The current token has been delivered by now, so an adopted token that never
+	// expires is revoked without one.
+	var revokeErr error
+	switch {
+	case tokenConfig.RevokePreviousAfter != "":
+		revokeErr = e.revokeSupersededTokens(ctx, tokenConfig, existingToken, existingTokens)
+	case tokenConfig.OnNonExpiring == config.NonExpiringAdoptAndRotate:
+		if adopted := supersededNonExpiring(existingToken, existingTokens); len(adopted) > 0 {
+			revokeErr = e.revokeTokens(ctx, tokenConfig, existingToken, adopted)
+		}
+	default:
+		reportSupersededNonExpiring(ctx, tokenConfig, existingToken, existingTokens)
+	}
+	if revokeErr != nil {
+		span.RecordError(revokeErr)
+		span.SetStatus(codes.Error, "failed to revoke superseded tokens")
+		return fmt.Errorf("failed to revoke superseded tokens for %s: %w", tokenConfig.Label, revokeErr)
+	}
+
 	// Token exists, check if it needs rotation
 	existingToken.Validity = validity
 
@@ -102,9 +197,29 @@ func (e *Engine) ProcessToken(ctx context.Context, tokenConfig config.TokenConfi
 	observability.RecordTokenValidityRemaining(ctx, tokenConfig.Label, validityRemaining)
 	span.SetAttributes(attribute.Float64("token.validity_remaining_seconds", validityRemaining))
 
+	// A token with other scopes than configured is replaced right away, so tightening
+	// the scopes doesn't leave an over-privileged token around until it expires
+	if scopesDrifted(tokenConfig.Scopes, existingToken.Scopes) {
+		span.SetAttributes(
+			attribute.String("token.rotation_reason", rotationReasonScopes),
+			attribute.String("token.scopes.configured", linode.NormalizeScopes(tokenConfig.Scopes)),
+			attribute.String("token.scopes.current", linode.NormalizeScopes(existingToken.Scopes)),
+		)
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.String("reason", rotationReasonScopes),
+			slog.String("configured_scopes", linode.NormalizeScopes(tokenConfig.Scopes)),
+			slog.String("current_scopes", linode.NormalizeScopes(existingToken.Scopes)),
+		}, observability.TraceAttrs(ctx)...)
+		logger.InfoContext(ctx, "Token scopes differ from the configuration, rotating", attrs...)
+		return e.rotateToken(ctx, tokenConfig, existingToken, validity)
+	}
+
 	if existingToken.NeedsRotation(thresholdPercent) {
+		span.SetAttributes(attribute.String("token.rotation_reason", rotationReasonExpiry))
 		attrs := append([]any{
 			slog.String("token_label", tokenConfig.Label),
+			slog.String("reason", rotationReasonExpiry),
 			slog.Float64("validity_remaining_percent", existingToken.PercentValidityRemaining()),
 		}, observability.TraceAttrs(ctx)...)
 		logger.InfoContext(ctx, "Token needs rotation", attrs...)
@@ -120,6 +235,78 @@ func (e *Engine) ProcessToken(ctx context.Context, tokenConfig config.TokenConfi
 	return nil
 }
 
+// Reasons for rotating an existing token, as logged and recorded on spans
+const (
+	rotationReasonExpiry      = "expiry"
+	rotationReasonScopes      = "scope_drift"
+	rotationReasonNonExpiring = "non_expiring"
+)
+
+// checkNonExpiringToken applies the token's on_non_expiring policy to a current token
+// that never expires, and reports whether it should be rotated
+func (e *Engine) checkNonExpiringToken(ctx context.Context, tokenConfig config.TokenConfig, token *models.Token) (bool, error) {
+	attrs := append([]any{
+		slog.String("token_label", tokenConfig.Label),
+		slog.Int("token_id", token.ID),
+		slog.String("policy", tokenConfig.OnNonExpiring),
+	}, observability.TraceAttrs(ctx)...)
+
+	switch tokenConfig.OnNonExpiring {
+	case config.NonExpiringIgnore:
+		observability.GetLogger().WarnContext(ctx, "Token never expires, leaving it alone", attrs...)
+		return false, nil
+	case config.NonExpiringFail:
+		return false, fmt.Errorf("token %s (ID %d) never expires", tokenConfig.Label, token.ID)
+	default:
+		attrs = append(attrs, slog.String("reason", rotationReasonNonExpiring))
+		observability.GetLogger().WarnContext(ctx, "Token never expires, replacing it with an expiring token", attrs...)
+		return true, nil
+	}
+}
+
+// supersededNonExpiring returns the tokens other than current that never expire
+func supersededNonExpiring(current *models.Token, tokens []*models.Token) []*models.Token {
+	var superseded []*models.Token
+	for _, t := range tokens {
+		if t.ID != current.ID && t.NeverExpires {
+			superseded = append(superseded, t)
+		}
+	}
+	return superseded
+}
+
+// reportSupersededNonExpiring warns about superseded tokens that never expire, since
+// without revoke_previous_after they stay valid for good
+func reportSupersededNonExpiring(ctx context.Context, tokenConfig config.TokenConfig, current *models.Token, tokens []*models.Token) {
+	for _, t := range supersededNonExpiring(current, tokens) {
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.Int("superseded_token_id", t.ID),
+			slog.Int("current_token_id", current.ID),
+		}, observability.TraceAttrs(ctx)...)
+		observability.GetLogger().WarnContext(ctx, "Superseded token never expires, set revoke_previous_after to revoke it", attrs...)
+	}
+}
+
+// scopesDrifted reports whether a token's current scopes grant other access than the
+// configured ones. Order, spacing and redundant scopes don't matter. Tokens whose scopes
+// Linode didn't report are left alone.
+func scopesDrifted(configured, current string) bool {
+	if strings.TrimSpace(current) == "" {
+		return false
+	}
+
+	configuredScopes, err := linode.ParseScopes(configured)
+	if err != nil {
+		return linode.NormalizeScopes(configured) != linode.NormalizeScopes(current)
+	}
+	currentScopes, err := linode.ParseScopes(current)
+	if err != nil {
+		return linode.NormalizeScopes(configured) != linode.NormalizeScopes(current)
+	}
+	return !configuredScopes.Equal(currentScopes)
+}
+
 // createNewToken creates a new token that doesn't exist yet
 func (e *Engine) createNewToken(ctx context.Context, tokenConfig config.TokenConfig, validity time.Duration) error {
 	logger := observability.GetLogger()
@@ -147,7 +334,8 @@ func (e *Engine) createNewToken(ctx context.Context, tokenConfig config.TokenCon
 
 	// Read existing state (if any)
 	storagePath := tokenConfig.Storage[0].Path
-	existingState, err := e.vaultClient.ReadTokenState(ctx, storagePath)
+	stateCtx := stateContext(ctx, tokenConfig)
+	existingState, err := e.vaultClient.ReadTokenState(stateCtx, storagePath)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to read token state")
@@ -155,11 +343,23 @@ func (e *Engine) createNewToken(ctx context.Context, tokenConfig config.TokenCon
 		return fmt.Errorf("failed to read token state: %w", err)
 	}
 
+	// Remember what the backends hold, in case the delivery has to be rolled back
+	var snapshots []backendSnapshot
+	if tokenConfig.OnStorageFailure == config.StorageFailureRollback {
+		snapshots, err = e.snapshotBackends(ctx, tokenConfig, existingState)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to read storage")
+			observability.RecordRotation(ctx, tokenConfig.Label, false)
+			return fmt.Errorf("failed to read storage for %s: %w", tokenConfig.Label, err)
+		}
+	}
+
 	// Calculate expiry
 	expiry := time.Now().Add(validity)
 
 	// Create token in Linode
-	newToken, err := e.linodeClient.CreateToken(ctx, tokenConfig.Label, tokenConfig.Scopes, expiry)
+	newToken, err := e.linodeFor(tokenConfig).CreateToken(ctx, tokenConfig.Label, tokenConfig.Scopes, expiry)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to create token")
@@ -174,21 +374,36 @@ func (e *Engine) createNewToken(ctx context.Context, tokenConfig config.TokenCon
 		slog.Time("expires_at", newToken.ExpiresAt),
 	}, observability.TraceAttrs(ctx)...)
 	logger.InfoContext(ctx, "Created token", attrs...)
+	e.savePendingToken(ctx, tokenConfig, newToken)
+
+	if err := e.checkNewToken(ctx, tokenConfig, newToken); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to verify token")
+		observability.RecordRotation(ctx, tokenConfig.Label, false)
+		observability.RecordRotationDuration(ctx, tokenConfig.Label, time.Since(startTime))
+		return err
+	}
 
 	// Store token in all configured storage backends
-	if err := e.storeTokenInBackends(ctx, tokenConfig.Storage, newToken.Token); err != nil {
-		// Track state even if storage fails, so we can retry on next run
-		_ = e.updateState(ctx, storagePath, newToken, existingState, expiry)
+	delivered, superseded, err := e.deliverToken(ctx, tokenConfig, newToken, existingState)
+	if err != nil {
+		e.handleDeliveryFailure(ctx, tokenConfig, newToken, snapshots, err, func() error {
+			return e.updateState(stateCtx, storagePath, newToken, existingState, expiry, delivered)
+		})
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to store token")
 		observability.RecordRotation(ctx, tokenConfig.Label, false)
 		observability.RecordRotationDuration(ctx, tokenConfig.Label, time.Since(startTime))
-		observability.RecordVaultStorageError(ctx, storagePath)
-		return fmt.Errorf("failed to store token in vault: %w", err)
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+	if superseded {
+		e.clearPendingToken(ctx, tokenConfig, newToken.ID)
+		span.SetStatus(codes.Ok, "superseded by concurrent rotation")
+		return nil
 	}
 
 	// Update state
-	if err := e.updateState(ctx, storagePath, newToken, existingState, expiry); err != nil {
+	if err := e.updateState(stateCtx, storagePath, newToken, existingState, expiry, delivered); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to update state")
 		observability.RecordRotation(ctx, tokenConfig.Label, false)
@@ -196,6 +411,9 @@ func (e *Engine) createNewToken(ctx context.Context, tokenConfig config.TokenCon
 		return fmt.Errorf("failed to update token state: %w", err)
 	}
 
+	e.clearPendingToken(ctx, tokenConfig, newToken.ID)
+	e.useNewSelfToken(ctx, tokenConfig, newToken.ID, newToken.Token)
+
 	// Record successful rotation
 	span.SetStatus(codes.Ok, "token created successfully")
 	observability.RecordRotation(ctx, tokenConfig.Label, true)
@@ -235,7 +453,8 @@ func (e *Engine) rotateToken(ctx context.Context, tokenConfig config.TokenConfig
 
 	// Read existing state
 	storagePath := tokenConfig.Storage[0].Path
-	existingState, err := e.vaultClient.ReadTokenState(ctx, storagePath)
+	stateCtx := stateContext(ctx, tokenConfig)
+	existingState, err := e.vaultClient.ReadTokenState(stateCtx, storagePath)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to read token state")
@@ -243,11 +462,23 @@ func (e *Engine) rotateToken(ctx context.Context, tokenConfig config.TokenConfig
 		return fmt.Errorf("failed to read token state: %w", err)
 	}
 
+	// Remember what the backends hold, in case the delivery has to be rolled back
+	var snapshots []backendSnapshot
+	if tokenConfig.OnStorageFailure == config.StorageFailureRollback {
+		snapshots, err = e.snapshotBackends(ctx, tokenConfig, existingState)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to read storage")
+			observability.RecordRotation(ctx, tokenConfig.Label, false)
+			return fmt.Errorf("failed to read storage for %s: %w", tokenConfig.Label, err)
+		}
+	}
+
 	// Calculate new expiry
 	newExpiry := time.Now().Add(validity)
 
 	// Create new token in Linode
-	newToken, err := e.linodeClient.CreateToken(ctx, tokenConfig.Label, tokenConfig.Scopes, newExpiry)
+	newToken, err := e.linodeFor(tokenConfig).CreateToken(ctx, tokenConfig.Label, tokenConfig.Scopes, newExpiry)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to create token")
@@ -266,21 +497,36 @@ func (e *Engine) rotateToken(ctx context.Context, tokenConfig config.TokenConfig
 		slog.Time("previous_expires_at", existingToken.ExpiresAt),
 	}, observability.TraceAttrs(ctx)...)
 	logger.InfoContext(ctx, "Created new token during rotation", attrs...)
+	e.savePendingToken(ctx, tokenConfig, newToken)
+
+	if err := e.checkNewToken(ctx, tokenConfig, newToken); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to verify token")
+		observability.RecordRotation(ctx, tokenConfig.Label, false)
+		observability.RecordRotationDuration(ctx, tokenConfig.Label, time.Since(startTime))
+		return err
+	}
 
 	// Store new token in all configured storage backends
-	if err := e.storeTokenInBackends(ctx, tokenConfig.Storage, newToken.Token); err != nil {
-		// Track state even if storage fails
-		_ = e.updateStateAfterRotation(ctx, storagePath, newToken, existingToken, existingState)
+	delivered, superseded, err := e.deliverToken(ctx, tokenConfig, newToken, existingState)
+	if err != nil {
+		e.handleDeliveryFailure(ctx, tokenConfig, newToken, snapshots, err, func() error {
+			return e.updateStateAfterRotation(stateCtx, storagePath, newToken, existingToken, existingState, delivered)
+		})
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to store token")
 		observability.RecordRotation(ctx, tokenConfig.Label, false)
 		observability.RecordRotationDuration(ctx, tokenConfig.Label, time.Since(startTime))
-		observability.RecordVaultStorageError(ctx, storagePath)
-		return fmt.Errorf("failed to store token in vault: %w", err)
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+	if superseded {
+		e.clearPendingToken(ctx, tokenConfig, newToken.ID)
+		span.SetStatus(codes.Ok, "superseded by concurrent rotation")
+		return nil
 	}
 
 	// Update state with previous token info
-	if err := e.updateStateAfterRotation(ctx, storagePath, newToken, existingToken, existingState); err != nil {
+	if err := e.updateStateAfterRotation(stateCtx, storagePath, newToken, existingToken, existingState, delivered); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to update state")
 		observability.RecordRotation(ctx, tokenConfig.Label, false)
@@ -288,6 +534,9 @@ func (e *Engine) rotateToken(ctx context.Context, tokenConfig config.TokenConfig
 		return fmt.Errorf("failed to update token state: %w", err)
 	}
 
+	e.clearPendingToken(ctx, tokenConfig, newToken.ID)
+	e.useNewSelfToken(ctx, tokenConfig, newToken.ID, newToken.Token)
+
 	// Record successful rotation
 	span.SetStatus(codes.Ok, "token rotated successfully")
 	observability.RecordRotation(ctx, tokenConfig.Label, true)
@@ -296,27 +545,323 @@ func (e *Engine) rotateToken(ctx context.Context, tokenConfig config.TokenConfig
 	return nil
 }
 
-// storeTokenInBackends stores the token in all configured storage backends
-func (e *Engine) storeTokenInBackends(ctx context.Context, storageConfigs []config.StorageConfig, token string) error {
+// revokeSupersededTokens deletes every token sharing the label of the current token
+// once the current token is older than the configured revoke_previous_after window,
+// then clears the previous token fields from the stored state
+func (e *Engine) revokeSupersededTokens(ctx context.Context, tokenConfig config.TokenConfig, current *models.Token, tokens []*models.Token) error {
+	gracePeriod, err := config.ParseValidityDuration(tokenConfig.RevokePreviousAfter)
+	if err != nil {
+		return fmt.Errorf("invalid revoke_previous_after: %w", err)
+	}
+
+	// Older tokens were superseded when the current token was created
+	if time.Since(current.CreatedAt) < gracePeriod {
+		return nil
+	}
+
+	return e.revokeTokens(ctx, tokenConfig, current, tokens)
+}
+
+// revokeTokens deletes the given tokens superseded by current, then clears the
+// previous token fields from the stored state
+// The state is only read and written once a token was actually revoked, so cycles
+// with nothing left to revoke don't touch it.
+func (e *Engine) revokeTokens(ctx context.Context, tokenConfig config.TokenConfig, current *models.Token, tokens []*models.Token) error {
 	logger := observability.GetLogger()
 
-	for _, storage := range storageConfigs {
-		if storage.Type == "vault" {
-			if err := e.vaultClient.WriteToken(ctx, storage.Path, token); err != nil {
-				return err
-			}
-			attrs := append([]any{
-				slog.String("storage_type", "vault"),
-				slog.String("vault_path", storage.Path),
-			}, observability.TraceAttrs(ctx)...)
-			logger.InfoContext(ctx, "Stored token in Vault", attrs...)
+	superseded := false
+	for _, t := range tokens {
+		if t.ID != current.ID {
+			superseded = true
+			break
+		}
+	}
+	if !superseded {
+		return nil
+	}
+
+	tracer := observability.GetTracer()
+	ctx, span := tracer.Start(ctx, "RevokeSupersededTokens")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("token.label", tokenConfig.Label),
+		attribute.Int("token.current_id", current.ID),
+	)
+
+	revoked := 0
+	for _, t := range tokens {
+		if t.ID == current.ID {
+			continue
+		}
+
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.Int("revoked_token_id", t.ID),
+			slog.Int("current_token_id", current.ID),
+			slog.Bool("dry_run", e.dryRun),
+		}, observability.TraceAttrs(ctx)...)
+
+		if e.dryRun {
+			logger.InfoContext(ctx, "DRY RUN: Would revoke superseded token", attrs...)
+			continue
 		}
+
+		if err := e.linodeFor(tokenConfig).DeleteToken(ctx, t.ID); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to delete token")
+			return fmt.Errorf("failed to delete token %d: %w", t.ID, err)
+		}
+		revoked++
+		logger.InfoContext(ctx, "Revoked superseded token", attrs...)
+	}
+
+	span.SetAttributes(attribute.Int("tokens.revoked", revoked))
+
+	// Only dry runs get here without revoking anything
+	if revoked == 0 {
+		span.SetStatus(codes.Ok, "dry run")
+		return nil
+	}
+
+	// Clear previous token info from state now that it has been revoked
+	storagePath := tokenConfig.Storage[0].Path
+	stateCtx := stateContext(ctx, tokenConfig)
+	state, err := e.vaultClient.ReadTokenState(stateCtx, storagePath)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to read token state")
+		return fmt.Errorf("failed to read token state: %w", err)
+	}
+
+	if state != nil && state.PreviousLinodeID != 0 && state.PreviousLinodeID != current.ID {
+		state.PreviousLinodeID = 0
+		state.PreviousExpiresAt = time.Time{}
+		if err := e.vaultClient.WriteTokenState(stateCtx, storagePath, state); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to update state")
+			return fmt.Errorf("failed to update token state: %w", err)
+		}
+	}
+
+	span.SetStatus(codes.Ok, "superseded tokens revoked")
+	return nil
+}
+
+// stateContext scopes state requests to the Vault namespace and mount of the first
+// storage entry, which is where the token state is kept
+func stateContext(ctx context.Context, tokenConfig config.TokenConfig) context.Context {
+	ctx = vault.WithNamespace(ctx, tokenConfig.Storage[0].VaultNamespace())
+	return vault.WithMount(ctx, tokenConfig.Storage[0].VaultMount())
+}
+
+// deliverToken stores newToken in every storage backend
+// The write to the first backend is a check-and-set against the version read with
+// the token state, so that a concurrent rotation (another replica or a manual edit)
+// is detected instead of silently overwritten. The token's Linode ID is written with
+// it, so after a conflict the winner is known from the stored token itself, even if
+// its rotation hasn't written the state yet. superseded is true when another
+// rotation delivered its token first. Either way a conflict revokes newToken, since
+// a token changed outside of latr may be in use and isn't overwritten.
+// The returned delivery is nil if no backend was written.
+func (e *Engine) deliverToken(ctx context.Context, tokenConfig config.TokenConfig, newToken *models.Token, existingState *models.TokenState) (delivery, bool, error) {
+	logger := observability.GetLogger()
+
+	version := 0
+	if existingState != nil {
+		version = existingState.Version
+	}
+
+	delivered, err := e.storeTokenInBackends(ctx, tokenConfig, newToken, version, nil)
+	if !errors.Is(err, vault.ErrVersionConflict) {
+		delivered, err = e.checkDelivery(ctx, tokenConfig, newToken.Token, delivered, err)
+		return delivered, false, err
+	}
+
+	attrs := append([]any{
+		slog.String("token_label", tokenConfig.Label),
+		slog.Int("token_id", newToken.ID),
+		slog.Int("expected_version", version),
+	}, observability.TraceAttrs(ctx)...)
+	logger.WarnContext(ctx, "Token was modified concurrently, reconciling", attrs...)
+
+	previousID := 0
+	if existingState != nil {
+		previousID = existingState.CurrentLinodeID
+	}
+
+	// Another rotation delivered a token in the meantime, keep it and discard ours
+	currentID, readErr := e.storedLinodeID(ctx, tokenConfig)
+	if readErr == nil && currentID != 0 && currentID != previousID {
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.Int("token_id", newToken.ID),
+			slog.Int("current_token_id", currentID),
+		}, observability.TraceAttrs(ctx)...)
+		logger.InfoContext(ctx, "Token was rotated concurrently, revoking the token created by this run", attrs...)
+
+		e.revokeUnusedToken(ctx, tokenConfig, newToken)
+		return nil, true, nil
+	}
+
+	// Changed outside of latr, or it can't be told by whom. Whatever is stored now may
+	// be in use, so give up rather than overwrite it, and let the next run start over.
+	attrs = append([]any{
+		slog.String("token_label", tokenConfig.Label),
+		slog.Int("token_id", newToken.ID),
+		slog.Int("current_token_id", currentID),
+		slog.Any("error", readErr),
+	}, observability.TraceAttrs(ctx)...)
+	logger.WarnContext(ctx, "Token was modified outside of a rotation, revoking the token created by this run", attrs...)
+
+	e.revokeUnusedToken(ctx, tokenConfig, newToken)
+	return nil, false, err
+}
+
+// storedLinodeID returns the Linode ID stored with the token in the first backend
+// 0 means the token was written without one, or the backend can't store it.
+func (e *Engine) storedLinodeID(ctx context.Context, tokenConfig config.TokenConfig) (int, error) {
+	backend, err := e.storages.New(tokenConfig.Storage[0])
+	if err != nil {
+		return 0, err
+	}
+	cas, ok := backend.(storage.CASStorage)
+	if !ok {
+		return 0, nil
+	}
+	return cas.ReadLinodeID(ctx)
+}
+
+// checkNewToken verifies newToken with the Linode API when verification is enabled
+// A token that fails is revoked before it's delivered anywhere.
+func (e *Engine) checkNewToken(ctx context.Context, tokenConfig config.TokenConfig, newToken *models.Token) error {
+	if e.verification == nil {
+		return nil
+	}
+	if err := e.verifyToken(ctx, tokenConfig, newToken); err != nil {
+		e.revokeUnusedToken(ctx, tokenConfig, newToken)
+		e.clearPendingToken(ctx, tokenConfig, newToken.ID)
+		return err
 	}
 	return nil
 }
 
+// checkDelivery reads a successfully delivered token back from its backends when
+// verification is enabled, otherwise delivered and err are returned as they are
+func (e *Engine) checkDelivery(ctx context.Context, tokenConfig config.TokenConfig, token string, delivered delivery, err error) (delivery, error) {
+	if err != nil || e.verification == nil {
+		return delivered, err
+	}
+	return e.verifyDelivery(ctx, tokenConfig, token, delivered)
+}
+
+// handleDeliveryFailure applies the token's on_storage_failure policy after newToken
+// couldn't be delivered. With rollback, the token is revoked and the backends restored.
+// Otherwise (or if the rollback fails) the token is kept: recordState tracks it in the
+// state, and its pending copy is redelivered on the next run.
+func (e *Engine) handleDeliveryFailure(ctx context.Context, tokenConfig config.TokenConfig, newToken *models.Token, snapshots []backendSnapshot, deliveryErr error, recordState func() error) {
+	// The token was already revoked in favour of a concurrent rotation
+	if errors.Is(deliveryErr, vault.ErrVersionConflict) {
+		e.clearPendingToken(ctx, tokenConfig, newToken.ID)
+		return
+	}
+
+	if tokenConfig.OnStorageFailure == config.StorageFailureRollback {
+		err := e.rollbackToken(ctx, tokenConfig, newToken, snapshots)
+		if err == nil {
+			return
+		}
+
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.Int("token_id", newToken.ID),
+			slog.Any("error", err),
+		}, observability.TraceAttrs(ctx)...)
+		observability.GetLogger().ErrorContext(ctx, "Failed to roll back token, keeping it", attrs...)
+	}
+
+	_ = recordState()
+}
+
+// revokeUnusedToken deletes a token that was created but never delivered
+// Failures are only logged, the token still expires on its own
+func (e *Engine) revokeUnusedToken(ctx context.Context, tokenConfig config.TokenConfig, token *models.Token) {
+	if err := e.linodeFor(tokenConfig).DeleteToken(ctx, token.ID); err != nil {
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.Int("token_id", token.ID),
+			slog.Any("error", err),
+		}, observability.TraceAttrs(ctx)...)
+		observability.GetLogger().ErrorContext(ctx, "Failed to revoke unused token", attrs...)
+	}
+}
+
+// storeTokenInBackends stores the token in all configured storage backends
+// The first backend is written with check-and-set against version when it supports it,
+// along with the token's Linode ID.
+// Every backend is written even if an earlier one fails, and the returned delivery
+// records which ones received the token. Backends in skip already hold it and are
+// left alone. A *DeliveryError lists the backends that failed.
+func (e *Engine) storeTokenInBackends(ctx context.Context, tokenConfig config.TokenConfig, token *models.Token, version int, skip map[string]bool) (delivery, error) {
+	logger := observability.GetLogger()
+
+	// Set up every backend first, so a configuration error doesn't leave a partial delivery
+	backends := make([]storage.Storage, 0, len(tokenConfig.Storage))
+	for _, storageConfig := range tokenConfig.Storage {
+		backend, err := e.storages.New(storageConfig)
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, backend)
+	}
+
+	delivered := make(delivery, len(backends))
+	var failed []BackendFailure
+	for i, backend := range backends {
+		key := backendKey(backend)
+		if skip[key] {
+			delivered[key] = true
+			continue
+		}
+
+		var err error
+		if cas, ok := backend.(storage.CASStorage); ok && i == 0 {
+			err = cas.WriteCAS(ctx, token.Token, token.ID, version)
+		} else {
+			err = backend.Write(ctx, token.Token)
+		}
+		// Nothing has been written yet, the caller decides whether the token is still needed
+		if errors.Is(err, vault.ErrVersionConflict) {
+			return nil, fmt.Errorf("failed to write token to %s: %w", backend.Describe(), err)
+		}
+
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.String("storage_type", tokenConfig.Storage[i].Type),
+			slog.String("storage", backend.Describe()),
+		}, observability.TraceAttrs(ctx)...)
+
+		if err != nil {
+			delivered[key] = false
+			failed = append(failed, BackendFailure{Backend: backend.Describe(), Err: err})
+			observability.RecordStorageError(ctx, tokenConfig.Label, tokenConfig.Storage[i].Type, tokenConfig.Storage[i].Path, backend.Describe())
+			logger.ErrorContext(ctx, "Failed to store token", append(attrs, slog.Any("error", err))...)
+			continue
+		}
+
+		delivered[key] = true
+		logger.InfoContext(ctx, "Stored token", attrs...)
+	}
+
+	if len(failed) > 0 {
+		return delivered, &DeliveryError{Failed: failed, Total: len(backends)}
+	}
+	return delivered, nil
+}
+
 // updateState updates the token state after creation
-func (e *Engine) updateState(ctx context.Context, path string, newToken *models.Token, existingState *models.TokenState, expiry time.Time) error {
+// delivered records the storage backends newToken reached
+func (e *Engine) updateState(ctx context.Context, path string, newToken *models.Token, existingState *models.TokenState, expiry time.Time, delivered delivery) error {
 	rotationCount := 0
 	if existingState != nil {
 		rotationCount = existingState.RotationCount
@@ -330,17 +875,24 @@ func (e *Engine) updateState(ctx context.Context, path string, newToken *models.
 		PreviousLinodeID:  0,
 		PreviousExpiresAt: time.Time{},
 		RotationCount:     rotationCount,
+		DeliveredLinodeID: deliveredID(newToken, existingState, delivered),
+		Backends:          deliveredBackends(newToken, existingState, delivered),
 	}
 
 	return e.vaultClient.WriteTokenState(ctx, path, state)
 }
 
 // updateStateAfterRotation updates the token state after rotation
-func (e *Engine) updateStateAfterRotation(ctx context.Context, path string, newToken, oldToken *models.Token, existingState *models.TokenState) error {
+// delivered records the storage backends newToken reached
+func (e *Engine) updateStateAfterRotation(ctx context.Context, path string, newToken, oldToken *models.Token, existingState *models.TokenState, delivered delivery) error {
 	rotationCount := 0
 	if existingState != nil {
 		rotationCount = existingState.RotationCount
 	}
+	// The rotation only counts once every backend holds the new token
+	if delivered.complete() {
+		rotationCount++
+	}
 
 	state := &models.TokenState{
 		Label:             newToken.Label,
@@ -349,8 +901,21 @@ func (e *Engine) updateStateAfterRotation(ctx context.Context, path string, newT
 		LastRotatedAt:     time.Now(),
 		PreviousLinodeID:  oldToken.ID,
 		PreviousExpiresAt: oldToken.ExpiresAt,
-		RotationCount:     rotationCount + 1,
+		RotationCount:     rotationCount,
+		DeliveredLinodeID: deliveredID(newToken, existingState, delivered),
+		Backends:          deliveredBackends(newToken, existingState, delivered),
 	}
 
 	return e.vaultClient.WriteTokenState(ctx, path, state)
 }
+
+// deliveredID returns the ID of the token the storage backends hold after delivering newToken
+func deliveredID(newToken *models.Token, existingState *models.TokenState, delivered delivery) int {
+	if delivered.complete() {
+		return newToken.ID
+	}
+	if existingState != nil {
+		return existingState.DeliveredLinodeID
+	}
+	return 0
+}
@@ -3,6 +3,9 @@ package rotation
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -10,6 +13,10 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/leader"
+	"github.com/wbh1/latr/internal/linode"
+	"github.com/wbh1/latr/internal/storage"
+	"github.com/wbh1/latr/internal/vault"
 	"github.com/wbh1/latr/pkg/models"
 )
 
@@ -31,9 +38,17 @@ func (m *MockLinodeClient) FindTokenByLabel(ctx context.Context, label string) (
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
+	if tokens, ok := args.Get(0).([]*models.Token); ok {
+		return tokens, args.Error(1)
+	}
 	return []*models.Token{args.Get(0).(*models.Token)}, args.Error(1)
 }
 
+func (m *MockLinodeClient) DeleteToken(ctx context.Context, tokenID int) error {
+	args := m.Called(ctx, tokenID)
+	return args.Error(0)
+}
+
 // MockVaultClient is a mock implementation of the Vault client
 type MockVaultClient struct {
 	mock.Mock
@@ -49,6 +64,11 @@ func (m *MockVaultClient) ReadToken(ctx context.Context, path string) (string, e
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockVaultClient) DeleteToken(ctx context.Context, path string) error {
+	args := m.Called(ctx, path)
+	return args.Error(0)
+}
+
 func (m *MockVaultClient) WriteTokenState(ctx context.Context, path string, state *models.TokenState) error {
 	args := m.Called(ctx, path, state)
 	return args.Error(0)
@@ -62,6 +82,41 @@ func (m *MockVaultClient) ReadTokenState(ctx context.Context, path string) (*mod
 	return args.Get(0).(*models.TokenState), args.Error(1)
 }
 
+// MockCASVaultClient is a mock Vault client that supports check-and-set writes
+type MockCASVaultClient struct {
+	MockVaultClient
+}
+
+func (m *MockCASVaultClient) WriteTokenCAS(ctx context.Context, path, token string, linodeID, version int) error {
+	args := m.Called(ctx, path, token, linodeID, version)
+	return args.Error(0)
+}
+
+func (m *MockCASVaultClient) ReadTokenLinodeID(ctx context.Context, path string) (int, error) {
+	args := m.Called(ctx, path)
+	return args.Int(0), args.Error(1)
+}
+
+// MockKubernetesClient is a mock implementation of the Kubernetes client
+type MockKubernetesClient struct {
+	mock.Mock
+}
+
+func (m *MockKubernetesClient) WriteSecretKey(ctx context.Context, namespace, name, key, value string) error {
+	args := m.Called(ctx, namespace, name, key, value)
+	return args.Error(0)
+}
+
+func (m *MockKubernetesClient) ReadSecretKey(ctx context.Context, namespace, name, key string) (string, error) {
+	args := m.Called(ctx, namespace, name, key)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockKubernetesClient) DeleteSecretKey(ctx context.Context, namespace, name, key string) error {
+	args := m.Called(ctx, namespace, name, key)
+	return args.Error(0)
+}
+
 func TestEngine_ProcessToken_NewToken(t *testing.T) {
 	mockLinode := new(MockLinodeClient)
 	mockVault := new(MockVaultClient)
@@ -99,6 +154,7 @@ func TestEngine_ProcessToken_NewToken(t *testing.T) {
 	engine := &Engine{
 		linodeClient: mockLinode,
 		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
 		dryRun:       false,
 	}
 
@@ -140,6 +196,7 @@ func TestEngine_ProcessToken_ExistingToken_NoRotationNeeded(t *testing.T) {
 	engine := &Engine{
 		linodeClient: mockLinode,
 		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
 		dryRun:       false,
 	}
 
@@ -206,6 +263,7 @@ func TestEngine_ProcessToken_ExistingToken_NeedsRotation(t *testing.T) {
 	engine := &Engine{
 		linodeClient: mockLinode,
 		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
 		dryRun:       false,
 	}
 
@@ -217,6 +275,103 @@ func TestEngine_ProcessToken_ExistingToken_NeedsRotation(t *testing.T) {
 	mockVault.AssertExpectations(t)
 }
 
+// rotationFixture returns a token due for rotation (ID 123) and the token replacing it (ID 456)
+func rotationFixture() (config.TokenConfig, *models.Token, *models.Token) {
+	tokenConfig := config.TokenConfig{
+		Label:    "existing-token",
+		Team:     "platform",
+		Validity: "90d",
+		Scopes:   "*",
+		Storage: []config.StorageConfig{
+			{Type: "vault", Path: "linode/tokens/existing-token"},
+		},
+	}
+
+	now := time.Now()
+	existingToken := &models.Token{
+		ID:        123,
+		Label:     "existing-token",
+		CreatedAt: now.Add(-81 * 24 * time.Hour),
+		ExpiresAt: now.Add(9 * 24 * time.Hour),
+		Validity:  90 * 24 * time.Hour,
+	}
+	newToken := &models.Token{
+		ID:        456,
+		Label:     "existing-token",
+		Token:     "new-rotated-token",
+		CreatedAt: now,
+		ExpiresAt: now.Add(90 * 24 * time.Hour),
+		Validity:  90 * 24 * time.Hour,
+	}
+
+	return tokenConfig, existingToken, newToken
+}
+
+func TestEngine_ProcessToken_ConcurrentRotationWins(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockCASVaultClient)
+	tokenConfig, existingToken, newToken := rotationFixture()
+	path := "linode/tokens/existing-token"
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, "existing-token").Return(existingToken, nil)
+	mockLinode.On("CreateToken", mock.Anything, "existing-token", "*", mock.Anything).Return(newToken, nil)
+	// The token created by the losing rotation is revoked
+	mockLinode.On("DeleteToken", mock.Anything, 456).Return(nil)
+
+	mockVault.On("ReadTokenState", mock.Anything, path).
+		Return(&models.TokenState{CurrentLinodeID: 123, Version: 3}, nil).Once()
+	mockVault.On("WriteTokenCAS", mock.Anything, path, "new-rotated-token", 456, 3).
+		Return(fmt.Errorf("failed to write token to vault: %w", vault.ErrVersionConflict))
+	// Another replica delivered token 789 in the meantime, but hasn't written its state yet
+	mockVault.On("ReadTokenLinodeID", mock.Anything, path).Return(789, nil)
+
+	engine := &Engine{
+		linodeClient: mockLinode,
+		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
+	}
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.NoError(t, err)
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+	mockVault.AssertNotCalled(t, "WriteTokenState", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestEngine_ProcessToken_ConflictFromManualEditGivesUp(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockCASVaultClient)
+	tokenConfig, existingToken, newToken := rotationFixture()
+	path := "linode/tokens/existing-token"
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, "existing-token").Return(existingToken, nil)
+	mockLinode.On("CreateToken", mock.Anything, "existing-token", "*", mock.Anything).Return(newToken, nil)
+	mockLinode.On("DeleteToken", mock.Anything, 456).Return(nil)
+
+	mockVault.On("ReadTokenState", mock.Anything, path).
+		Return(&models.TokenState{CurrentLinodeID: 123, Version: 3}, nil).Once()
+	mockVault.On("WriteTokenCAS", mock.Anything, path, "new-rotated-token", 456, 3).
+		Return(fmt.Errorf("failed to write token to vault: %w", vault.ErrVersionConflict))
+	// Edited by hand, so no Linode ID was stored with the token
+	mockVault.On("ReadTokenLinodeID", mock.Anything, path).Return(0, nil)
+
+	engine := &Engine{
+		linodeClient: mockLinode,
+		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
+	}
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.ErrorIs(t, err, vault.ErrVersionConflict)
+
+	// The stored token isn't overwritten, and the token created by this run is revoked
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+	mockVault.AssertNumberOfCalls(t, "WriteTokenCAS", 1)
+	mockVault.AssertNotCalled(t, "WriteTokenState", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestEngine_ProcessToken_DryRunMode(t *testing.T) {
 	mockLinode := new(MockLinodeClient)
 	mockVault := new(MockVaultClient)
@@ -237,6 +392,7 @@ func TestEngine_ProcessToken_DryRunMode(t *testing.T) {
 	engine := &Engine{
 		linodeClient: mockLinode,
 		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
 		dryRun:       true,
 	}
 
@@ -273,6 +429,7 @@ func TestEngine_ProcessToken_LinodeCreateFails(t *testing.T) {
 	engine := &Engine{
 		linodeClient: mockLinode,
 		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
 		dryRun:       false,
 	}
 
@@ -322,14 +479,1107 @@ func TestEngine_ProcessToken_VaultWriteFails_StateTracked(t *testing.T) {
 	engine := &Engine{
 		linodeClient: mockLinode,
 		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
 		dryRun:       false,
 	}
 
 	ctx := context.Background()
 	err := engine.ProcessToken(ctx, tokenConfig, 10)
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to store token in vault")
+	assert.Contains(t, err.Error(), "failed to store token")
+	assert.Contains(t, err.Error(), "vault:secret/data/test/new-token: vault error")
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_RevokesSupersededToken(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+
+	tokenConfig := config.TokenConfig{
+		Label:               "existing-token",
+		Team:                "platform",
+		Validity:            "90d",
+		Scopes:              "*",
+		RevokePreviousAfter: "24h",
+		Storage: []config.StorageConfig{
+			{Type: "vault", Path: "secret/data/test/existing-token"},
+		},
+	}
+
+	now := time.Now()
+	previousToken := &models.Token{
+		ID:        123,
+		Label:     "existing-token",
+		CreatedAt: now.Add(-80 * 24 * time.Hour),
+		ExpiresAt: now.Add(10 * 24 * time.Hour),
+		Scopes:    "*",
+	}
+	currentToken := &models.Token{
+		ID:        456,
+		Label:     "existing-token",
+		CreatedAt: now.Add(-2 * 24 * time.Hour), // Rotated 2 days ago
+		ExpiresAt: now.Add(88 * 24 * time.Hour),
+		Scopes:    "*",
+	}
+
+	existingState := &models.TokenState{
+		Label:             "existing-token",
+		CurrentLinodeID:   456,
+		PreviousLinodeID:  123,
+		PreviousExpiresAt: previousToken.ExpiresAt,
+		RotationCount:     1,
+	}
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, "existing-token").Return([]*models.Token{previousToken, currentToken}, nil)
+	mockLinode.On("DeleteToken", mock.Anything, 123).Return(nil)
+
+	mockVault.On("ReadTokenState", mock.Anything, "secret/data/test/existing-token").Return(existingState, nil)
+	mockVault.On("WriteTokenState", mock.Anything, "secret/data/test/existing-token", mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.CurrentLinodeID == 456 &&
+			state.PreviousLinodeID == 0 &&
+			state.PreviousExpiresAt.IsZero() &&
+			state.RotationCount == 1
+	})).Return(nil)
+
+	engine := &Engine{
+		linodeClient: mockLinode,
+		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
+		dryRun:       false,
+	}
+
+	ctx := context.Background()
+	err := engine.ProcessToken(ctx, tokenConfig, 10)
+	require.NoError(t, err)
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+	mockLinode.AssertNotCalled(t, "DeleteToken", mock.Anything, 456)
+}
+
+func TestEngine_ProcessToken_SupersededTokenWithinGracePeriod(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+
+	tokenConfig := config.TokenConfig{
+		Label:               "existing-token",
+		Team:                "platform",
+		Validity:            "90d",
+		Scopes:              "*",
+		RevokePreviousAfter: "24h",
+		Storage: []config.StorageConfig{
+			{Type: "vault", Path: "secret/data/test/existing-token"},
+		},
+	}
+
+	now := time.Now()
+	previousToken := &models.Token{
+		ID:        123,
+		Label:     "existing-token",
+		CreatedAt: now.Add(-80 * 24 * time.Hour),
+		ExpiresAt: now.Add(10 * 24 * time.Hour),
+		Scopes:    "*",
+	}
+	currentToken := &models.Token{
+		ID:        456,
+		Label:     "existing-token",
+		CreatedAt: now.Add(-1 * time.Hour), // Rotated an hour ago
+		ExpiresAt: now.Add(90 * 24 * time.Hour),
+		Scopes:    "*",
+	}
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, "existing-token").Return([]*models.Token{previousToken, currentToken}, nil)
+
+	engine := &Engine{
+		linodeClient: mockLinode,
+		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
+		dryRun:       false,
+	}
+
+	ctx := context.Background()
+	err := engine.ProcessToken(ctx, tokenConfig, 10)
+	require.NoError(t, err)
+
+	mockLinode.AssertExpectations(t)
+	mockLinode.AssertNotCalled(t, "DeleteToken", mock.Anything, mock.Anything)
+	mockVault.AssertNotCalled(t, "WriteTokenState", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestEngine_ProcessToken_NothingToRevokeLeavesState(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+
+	tokenConfig := config.TokenConfig{
+		Label:               "existing-token",
+		Team:                "platform",
+		Validity:            "90d",
+		Scopes:              "*",
+		RevokePreviousAfter: "24h",
+		Storage: []config.StorageConfig{
+			{Type: "vault", Path: "secret/data/test/existing-token"},
+		},
+	}
+
+	now := time.Now()
+	currentToken := &models.Token{
+		ID:        456,
+		Label:     "existing-token",
+		CreatedAt: now.Add(-2 * 24 * time.Hour), // Past the grace period, the previous token is already gone
+		ExpiresAt: now.Add(88 * 24 * time.Hour),
+		Scopes:    "*",
+	}
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, "existing-token").Return([]*models.Token{currentToken}, nil)
+
+	engine := &Engine{
+		linodeClient: mockLinode,
+		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
+		dryRun:       false,
+	}
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.NoError(t, err)
+
+	mockLinode.AssertNotCalled(t, "DeleteToken", mock.Anything, mock.Anything)
+	mockVault.AssertNotCalled(t, "ReadTokenState", mock.Anything, mock.Anything)
+	mockVault.AssertNotCalled(t, "WriteTokenState", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestEngine_ProcessToken_NewToken_FileStorage(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+
+	tokenPath := filepath.Join(t.TempDir(), "linode.env")
+
+	tokenConfig := config.TokenConfig{
+		Label:    "new-token",
+		Team:     "platform",
+		Validity: "90d",
+		Scopes:   "*",
+		Storage: []config.StorageConfig{
+			{Type: "vault", Path: "secret/data/test/new-token"},
+			{Type: "file", Path: tokenPath, Options: map[string]interface{}{"mode": "0640", "format": "env"}},
+		},
+	}
+
+	now := time.Now()
+	createdToken := &models.Token{
+		ID:        123,
+		Label:     "new-token",
+		Token:     "new-secret-token",
+		CreatedAt: now,
+		ExpiresAt: now.Add(90 * 24 * time.Hour),
+		Scopes:    "*",
+		Validity:  90 * 24 * time.Hour,
+	}
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, "new-token").Return(nil, nil)
+	mockLinode.On("CreateToken", mock.Anything, "new-token", "*", mock.Anything).Return(createdToken, nil)
+
+	mockVault.On("ReadTokenState", mock.Anything, "secret/data/test/new-token").Return(nil, nil)
+	mockVault.On("WriteToken", mock.Anything, "secret/data/test/new-token", "new-secret-token").Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, "secret/data/test/new-token", mock.Anything).Return(nil)
+
+	engine := &Engine{
+		linodeClient: mockLinode,
+		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
+		dryRun:       false,
+	}
+
+	ctx := context.Background()
+	err := engine.ProcessToken(ctx, tokenConfig, 10)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(tokenPath)
+	require.NoError(t, err)
+	assert.Equal(t, "LINODE_TOKEN=new-secret-token\n", string(data))
+
+	info, err := os.Stat(tokenPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
 
 	mockLinode.AssertExpectations(t)
 	mockVault.AssertExpectations(t)
 }
+
+func TestEngine_ProcessToken_NewToken_KubernetesStorage(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	mockKube := new(MockKubernetesClient)
+
+	tokenConfig := config.TokenConfig{
+		Label:    "new-token",
+		Team:     "platform",
+		Validity: "90d",
+		Scopes:   "*",
+		Storage: []config.StorageConfig{
+			{Type: "vault", Path: "secret/data/test/new-token"},
+			{Type: "kubernetes", Path: "linode-token", Options: map[string]interface{}{"namespace": "apps"}},
+		},
+	}
+
+	now := time.Now()
+	createdToken := &models.Token{
+		ID:        123,
+		Label:     "new-token",
+		Token:     "new-secret-token",
+		CreatedAt: now,
+		ExpiresAt: now.Add(90 * 24 * time.Hour),
+		Scopes:    "*",
+		Validity:  90 * 24 * time.Hour,
+	}
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, "new-token").Return(nil, nil)
+	mockLinode.On("CreateToken", mock.Anything, "new-token", "*", mock.Anything).Return(createdToken, nil)
+
+	mockVault.On("ReadTokenState", mock.Anything, "secret/data/test/new-token").Return(nil, nil)
+	mockVault.On("WriteToken", mock.Anything, "secret/data/test/new-token", "new-secret-token").Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, "secret/data/test/new-token", mock.Anything).Return(nil)
+
+	// Key defaults to "token"
+	mockKube.On("WriteSecretKey", mock.Anything, "apps", "linode-token", "token", "new-secret-token").Return(nil)
+
+	engine := &Engine{
+		linodeClient: mockLinode,
+		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, mockKube),
+		dryRun:       false,
+	}
+
+	ctx := context.Background()
+	err := engine.ProcessToken(ctx, tokenConfig, 10)
+	require.NoError(t, err)
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+	mockKube.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_KubernetesStorageWithoutClient(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+
+	tokenConfig := config.TokenConfig{
+		Label:    "new-token",
+		Team:     "platform",
+		Validity: "90d",
+		Scopes:   "*",
+		Storage: []config.StorageConfig{
+			{Type: "kubernetes", Path: "linode-token", Options: map[string]interface{}{"namespace": "apps"}},
+		},
+	}
+
+	now := time.Now()
+	createdToken := &models.Token{
+		ID:        123,
+		Label:     "new-token",
+		Token:     "new-secret-token",
+		CreatedAt: now,
+		ExpiresAt: now.Add(90 * 24 * time.Hour),
+		Scopes:    "*",
+		Validity:  90 * 24 * time.Hour,
+	}
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, "new-token").Return(nil, nil)
+	mockLinode.On("CreateToken", mock.Anything, "new-token", "*", mock.Anything).Return(createdToken, nil)
+
+	mockVault.On("ReadTokenState", mock.Anything, "linode-token").Return(nil, nil)
+	mockVault.On("WriteTokenState", mock.Anything, "linode-token", mock.Anything).Return(nil)
+
+	engine := &Engine{
+		linodeClient: mockLinode,
+		vaultClient:  mockVault,
+		storages:     storage.NewDefaultRegistry(mockVault, nil),
+		dryRun:       false,
+	}
+
+	ctx := context.Background()
+	err := engine.ProcessToken(ctx, tokenConfig, 10)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no kubernetes client is available")
+}
+
+func fileTokenLocks(t *testing.T) (*TokenLocks, leader.Locker) {
+	t.Helper()
+
+	locker, err := leader.NewLocker(config.TokenLockConfig{Backend: config.LeaderElectionFile, Path: t.TempDir()}, nil, nil)
+	require.NoError(t, err)
+
+	return &TokenLocks{
+		Locker:        locker,
+		Identity:      "latr-test",
+		LeaseDuration: time.Minute,
+	}, locker
+}
+
+func TestEngine_ProcessToken_HoldsTokenLock(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, _ := rotationFixture()
+	current.CreatedAt = time.Now()
+	current.ExpiresAt = time.Now().Add(90 * 24 * time.Hour)
+
+	locks, locker := fileTokenLocks(t)
+	lock := locker(tokenConfig)
+
+	// Another process can't take the lock while the token is being processed
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil).Run(func(args mock.Arguments) {
+		acquired, err := lock.TryAcquire(context.Background(), "other", time.Minute)
+		require.NoError(t, err)
+		assert.False(t, acquired)
+	})
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+	engine.SetTokenLocks(locks)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+	mockLinode.AssertExpectations(t)
+
+	// The lock is released afterwards
+	acquired, err := lock.TryAcquire(context.Background(), "other", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestEngine_ProcessToken_SkipsLockedToken(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, _, _ := rotationFixture()
+
+	locks, locker := fileTokenLocks(t)
+	acquired, err := locker(tokenConfig).TryAcquire(context.Background(), "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+	engine.SetTokenLocks(locks)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+	mockLinode.AssertNotCalled(t, "FindTokenByLabel", mock.Anything, mock.Anything)
+}
+
+// unsupportedLock is a lock on a mount that can't hold one
+type unsupportedLock struct{}
+
+func (unsupportedLock) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	return false, vault.ErrLockUnsupported
+}
+func (unsupportedLock) Release(ctx context.Context, holder string) error { return nil }
+func (unsupportedLock) Describe() string                                 { return "vault:unsupported" }
+
+func TestEngine_ProcessToken_FailsWhenLockUnsupported(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, _, _ := rotationFixture()
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+	engine.SetTokenLocks(&TokenLocks{
+		Locker:        func(config.TokenConfig) leader.Lock { return unsupportedLock{} },
+		Identity:      "latr-test",
+		LeaseDuration: time.Minute,
+	})
+
+	// The token is never processed without its lock
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.ErrorIs(t, err, vault.ErrLockUnsupported)
+	mockLinode.AssertNotCalled(t, "FindTokenByLabel", mock.Anything, mock.Anything)
+}
+
+// MockPendingVaultClient is a mock Vault client that keeps pending tokens
+type MockPendingVaultClient struct {
+	MockVaultClient
+}
+
+func (m *MockPendingVaultClient) WritePendingToken(ctx context.Context, path string, token *models.Token) error {
+	args := m.Called(ctx, path, token)
+	return args.Error(0)
+}
+
+func (m *MockPendingVaultClient) ReadPendingToken(ctx context.Context, path string) (*models.Token, error) {
+	args := m.Called(ctx, path)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Token), args.Error(1)
+}
+
+func (m *MockPendingVaultClient) DeletePendingToken(ctx context.Context, path string) error {
+	args := m.Called(ctx, path)
+	return args.Error(0)
+}
+
+func TestEngine_ProcessToken_FailedDeliveryKeepsPendingToken(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockPendingVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockVault.On("ReadPendingToken", mock.Anything, path).Return(nil, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: 123, DeliveredLinodeID: 123}, nil)
+	mockVault.On("WritePendingToken", mock.Anything, path, newToken).Return(nil)
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(errors.New("vault error"))
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		// The backends still hold the previous token
+		return state.CurrentLinodeID == 456 && state.DeliveredLinodeID == 123
+	})).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+
+	mockVault.AssertExpectations(t)
+	mockVault.AssertNotCalled(t, "DeletePendingToken", mock.Anything, mock.Anything)
+}
+
+func TestEngine_ProcessToken_RedeliversPendingToken(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockPendingVaultClient)
+	tokenConfig, _, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	// The previous run created the token but failed to store it
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(newToken, nil)
+	mockVault.On("ReadPendingToken", mock.Anything, path).Return(&models.Token{ID: 456, Token: "new-rotated-token"}, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: 456, DeliveredLinodeID: 123, PreviousLinodeID: 123}, nil)
+	mockVault.On("WriteToken", mock.Anything, path, "new-rotated-token").Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.CurrentLinodeID == 456 && state.DeliveredLinodeID == 456 && state.PreviousLinodeID == 123
+	})).Return(nil)
+	mockVault.On("DeletePendingToken", mock.Anything, path).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	mockVault.AssertExpectations(t)
+	mockLinode.AssertNotCalled(t, "CreateToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// MockSwappingLinodeClient is a Linode client whose token can be replaced
+type MockSwappingLinodeClient struct {
+	MockLinodeClient
+}
+
+func (m *MockSwappingLinodeClient) SetToken(token string) {
+	m.Called(token)
+}
+
+func TestEngine_ProcessToken_SwitchesToNewSelfToken(t *testing.T) {
+	mockLinode := new(MockSwappingLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockLinode.On("SetToken", newToken.Token).Return().Once()
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: current.ID}, nil)
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.Anything).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+	engine.SetSelfToken(config.DefaultAccount, tokenConfig.Label)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	mockLinode.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_KeepsSelfTokenWhenDeliveryFails(t *testing.T) {
+	mockLinode := new(MockSwappingLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: current.ID}, nil)
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(errors.New("vault sealed"))
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.Anything).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+	engine.SetSelfToken(config.DefaultAccount, tokenConfig.Label)
+
+	require.Error(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	// The new token isn't in Vault, so latr would lose it on restart
+	mockLinode.AssertNotCalled(t, "SetToken", mock.Anything)
+}
+
+func TestEngine_ProcessToken_UsesAccountClient(t *testing.T) {
+	defaultLinode := new(MockSwappingLinodeClient)
+	stagingLinode := new(MockSwappingLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	tokenConfig.Account = "staging"
+	path := tokenConfig.Storage[0].Path
+
+	stagingLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	stagingLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	stagingLinode.On("SetToken", newToken.Token).Return().Once()
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: current.ID}, nil)
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.Anything).Return(nil)
+
+	engine := NewEngine(defaultLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+	engine.SetAccountClient("staging", stagingLinode)
+	// A token with the same label in the default account is a different token
+	engine.SetSelfToken(config.DefaultAccount, tokenConfig.Label)
+	engine.SetSelfToken("staging", tokenConfig.Label)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	stagingLinode.AssertExpectations(t)
+	defaultLinode.AssertNotCalled(t, "FindTokenByLabel", mock.Anything, mock.Anything)
+	defaultLinode.AssertNotCalled(t, "SetToken", mock.Anything)
+}
+
+func TestEngine_ProcessToken_UnknownAccount(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, _, _ := rotationFixture()
+	tokenConfig.Account = "missing"
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `no Linode client for account "missing"`)
+	mockLinode.AssertNotCalled(t, "FindTokenByLabel", mock.Anything, mock.Anything)
+}
+
+func TestEngine_ProcessToken_ReplacesNonExpiringToken(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	// Created by hand years ago without an expiry
+	current.CreatedAt = time.Now().Add(-3 * 365 * 24 * time.Hour)
+	current.ExpiresAt = time.Time{}
+	current.NeverExpires = true
+	tokenConfig.OnNonExpiring = config.NonExpiringAdoptAndRotate
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, tokenConfig.Scopes, mock.Anything).Return(newToken, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(nil, nil)
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.CurrentLinodeID == newToken.ID && state.PreviousLinodeID == current.ID
+	})).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_RevokesAdoptedNonExpiringToken(t *testing.T) {
+	for _, revokeAfter := range []string{"", "24h"} {
+		t.Run("revoke_previous_after="+revokeAfter, func(t *testing.T) {
+			mockLinode := new(MockLinodeClient)
+			mockVault := new(MockVaultClient)
+			tokenConfig, _, replacement := rotationFixture()
+			path := tokenConfig.Storage[0].Path
+
+			tokenConfig.OnNonExpiring = config.NonExpiringAdoptAndRotate
+			tokenConfig.RevokePreviousAfter = revokeAfter
+
+			// An earlier run replaced the adopted token, and the replacement has been delivered
+			adopted := &models.Token{ID: 123, Label: tokenConfig.Label, Scopes: "*", CreatedAt: time.Now().Add(-3 * 365 * 24 * time.Hour), NeverExpires: true}
+			replacement.CreatedAt = time.Now().Add(-48 * time.Hour)
+			replacement.ExpiresAt = replacement.CreatedAt.Add(90 * 24 * time.Hour)
+
+			mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return([]*models.Token{adopted, replacement}, nil)
+			mockLinode.On("DeleteToken", mock.Anything, adopted.ID).Return(nil)
+			mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{
+				CurrentLinodeID:   replacement.ID,
+				DeliveredLinodeID: replacement.ID,
+				PreviousLinodeID:  adopted.ID,
+			}, nil)
+			mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+				return state.CurrentLinodeID == replacement.ID && state.PreviousLinodeID == 0
+			})).Return(nil)
+
+			engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+			require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+			// The token that never expires doesn't stay valid for good
+			mockLinode.AssertCalled(t, "DeleteToken", mock.Anything, adopted.ID)
+			mockLinode.AssertNotCalled(t, "DeleteToken", mock.Anything, replacement.ID)
+			mockVault.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEngine_ProcessToken_AdoptedNonExpiringTokenWaitsForRevokeDelay(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, _, replacement := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	tokenConfig.OnNonExpiring = config.NonExpiringAdoptAndRotate
+	tokenConfig.RevokePreviousAfter = "24h"
+
+	adopted := &models.Token{ID: 123, Label: tokenConfig.Label, Scopes: "*", CreatedAt: time.Now().Add(-3 * 365 * 24 * time.Hour), NeverExpires: true}
+	replacement.CreatedAt = time.Now().Add(-time.Hour)
+	replacement.ExpiresAt = replacement.CreatedAt.Add(90 * 24 * time.Hour)
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return([]*models.Token{adopted, replacement}, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{
+		CurrentLinodeID:   replacement.ID,
+		DeliveredLinodeID: replacement.ID,
+		PreviousLinodeID:  adopted.ID,
+	}, nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	// revoke_previous_after only delays the revocation
+	mockLinode.AssertNotCalled(t, "DeleteToken", mock.Anything, mock.Anything)
+}
+
+func TestEngine_ProcessToken_NonExpiringPolicies(t *testing.T) {
+	for _, policy := range []string{config.NonExpiringIgnore, config.NonExpiringFail} {
+		t.Run(policy, func(t *testing.T) {
+			mockLinode := new(MockLinodeClient)
+			mockVault := new(MockVaultClient)
+			tokenConfig, current, _ := rotationFixture()
+
+			current.ExpiresAt = time.Time{}
+			current.NeverExpires = true
+			tokenConfig.OnNonExpiring = policy
+
+			mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+
+			engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+			err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+			if policy == config.NonExpiringFail {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "never expires")
+			} else {
+				require.NoError(t, err)
+			}
+
+			mockLinode.AssertNotCalled(t, "CreateToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			mockVault.AssertNotCalled(t, "WriteToken", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestEngine_ProcessToken_RotatesWhenDeliveredTokenIsLost(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockPendingVaultClient)
+	tokenConfig, _, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	// The backends hold token 123, but the value of the newer token 456 wasn't kept
+	replacement := &models.Token{ID: 789, Label: tokenConfig.Label, Token: "replacement-token", ExpiresAt: time.Now().Add(90 * 24 * time.Hour)}
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(newToken, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(replacement, nil)
+	mockVault.On("ReadPendingToken", mock.Anything, path).Return(nil, nil).Once()
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: 456, DeliveredLinodeID: 123}, nil)
+	mockVault.On("WritePendingToken", mock.Anything, path, replacement).Return(nil)
+	mockVault.On("WriteToken", mock.Anything, path, "replacement-token").Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.CurrentLinodeID == 789 && state.DeliveredLinodeID == 789
+	})).Return(nil)
+	mockVault.On("ReadPendingToken", mock.Anything, path).Return(replacement, nil)
+	mockVault.On("DeletePendingToken", mock.Anything, path).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_RollbackOnStorageFailure(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	// The second backend can't be written, since its directory doesn't exist
+	tokenConfig.OnStorageFailure = config.StorageFailureRollback
+	tokenConfig.Storage = append(tokenConfig.Storage, config.StorageConfig{
+		Type: "file",
+		Path: filepath.Join(t.TempDir(), "missing", "token"),
+	})
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockLinode.On("DeleteToken", mock.Anything, newToken.ID).Return(nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: current.ID}, nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return("old-token", nil).Once()
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return(newToken.Token, nil).Once()
+	mockVault.On("WriteToken", mock.Anything, path, "old-token").Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+
+	// The new token is revoked, the old value restored, and the state left alone
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+	mockVault.AssertNotCalled(t, "WriteTokenState", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestEngine_ProcessToken_RollbackRestoresLinodeID(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockCASVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	tokenConfig.OnStorageFailure = config.StorageFailureRollback
+	tokenConfig.Storage = append(tokenConfig.Storage, config.StorageConfig{
+		Type: "file",
+		Path: filepath.Join(t.TempDir(), "missing", "token"),
+	})
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockLinode.On("DeleteToken", mock.Anything, newToken.ID).Return(nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: current.ID, Version: 3}, nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return("old-token", nil).Once()
+	mockVault.On("ReadTokenLinodeID", mock.Anything, path).Return(current.ID, nil)
+	mockVault.On("WriteTokenCAS", mock.Anything, path, newToken.Token, newToken.ID, 3).Return(nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return(newToken.Token, nil).Once()
+	// The previous token goes back with its Linode ID, on top of the version the delivery wrote
+	mockVault.On("WriteTokenCAS", mock.Anything, path, "old-token", current.ID, 4).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+	mockVault.AssertNotCalled(t, "WriteToken", mock.Anything, mock.Anything, mock.Anything)
+	mockVault.AssertNotCalled(t, "WriteTokenState", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestEngine_ProcessToken_RollbackKeepsTokenWhenRestoreFails(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	tokenConfig.OnStorageFailure = config.StorageFailureRollback
+	tokenConfig.Storage = append(tokenConfig.Storage, config.StorageConfig{
+		Type: "file",
+		Path: filepath.Join(t.TempDir(), "missing", "token"),
+	})
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: current.ID}, nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return("old-token", nil).Once()
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return(newToken.Token, nil).Once()
+	mockVault.On("WriteToken", mock.Anything, path, "old-token").Return(errors.New("vault error"))
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.CurrentLinodeID == newToken.ID
+	})).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+
+	// Vault still holds the new token, so it must stay valid
+	mockLinode.AssertNotCalled(t, "DeleteToken", mock.Anything, mock.Anything)
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_RollbackRemovesTokenFromEmptyBackend(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	tokenConfig.OnStorageFailure = config.StorageFailureRollback
+	tokenConfig.Storage = append(tokenConfig.Storage, config.StorageConfig{
+		Type: "file",
+		Path: filepath.Join(t.TempDir(), "missing", "token"),
+	})
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockLinode.On("DeleteToken", mock.Anything, newToken.ID).Return(nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: current.ID}, nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return("", fmt.Errorf("%w at path: %s", vault.ErrNotFound, path)).Once()
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return(newToken.Token, nil).Once()
+	mockVault.On("DeleteToken", mock.Anything, path).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_RollbackSkippedWhenSnapshotFails(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	tokenConfig.OnStorageFailure = config.StorageFailureRollback
+	tokenConfig.Storage = append(tokenConfig.Storage, config.StorageConfig{
+		Type: "file",
+		Path: filepath.Join(t.TempDir(), "missing", "token"),
+	})
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: current.ID}, nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return("", errors.New("vault unavailable")).Once()
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.CurrentLinodeID == newToken.ID
+	})).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+
+	// What Vault held is unknown, so it keeps the new token and the token stays valid
+	mockLinode.AssertNotCalled(t, "DeleteToken", mock.Anything, mock.Anything)
+	mockVault.AssertNotCalled(t, "DeleteToken", mock.Anything, mock.Anything)
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_PartialDeliveryRecordsBackends(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockPendingVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	dir := t.TempDir()
+	delivered := filepath.Join(dir, "token")
+	failing := filepath.Join(dir, "missing", "token")
+	tokenConfig.Storage = append(tokenConfig.Storage,
+		config.StorageConfig{Type: "file", Path: failing},
+		config.StorageConfig{Type: "file", Path: delivered},
+	)
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockVault.On("ReadPendingToken", mock.Anything, path).Return(nil, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: 123, DeliveredLinodeID: 123}, nil)
+	mockVault.On("WritePendingToken", mock.Anything, path, newToken).Return(nil)
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.CurrentLinodeID == 456 && state.DeliveredLinodeID == 123 &&
+			assert.ObjectsAreEqual(map[string]int{"vault:" + path: 456, "file:" + delivered: 456}, state.Backends)
+	})).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to write token to 1 of 3 storage backends: file:"+failing)
+
+	var deliveryErr *DeliveryError
+	require.ErrorAs(t, err, &deliveryErr)
+	require.Len(t, deliveryErr.Failed, 1)
+	assert.Equal(t, "file:"+failing, deliveryErr.Failed[0].Backend)
+
+	// Backends after the failing one are still written
+	content, err := os.ReadFile(delivered)
+	require.NoError(t, err)
+	assert.Equal(t, newToken.Token+"\n", string(content))
+
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_RedeliversToFailedBackendsOnly(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockPendingVaultClient)
+	tokenConfig, _, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	retried := filepath.Join(t.TempDir(), "token")
+	tokenConfig.Storage = append(tokenConfig.Storage, config.StorageConfig{Type: "file", Path: retried})
+
+	// Vault received the token on the previous run, the file didn't
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(newToken, nil)
+	mockVault.On("ReadPendingToken", mock.Anything, path).Return(&models.Token{ID: 456, Token: "new-rotated-token"}, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{
+		CurrentLinodeID:   456,
+		DeliveredLinodeID: 123,
+		Backends:          map[string]int{"vault:" + path: 456, "file:" + retried: 123},
+	}, nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.DeliveredLinodeID == 456 &&
+			assert.ObjectsAreEqual(map[string]int{"vault:" + path: 456, "file:" + retried: 456}, state.Backends)
+	})).Return(nil)
+	mockVault.On("DeletePendingToken", mock.Anything, path).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	content, err := os.ReadFile(retried)
+	require.NoError(t, err)
+	assert.Equal(t, "new-rotated-token\n", string(content))
+
+	mockVault.AssertExpectations(t)
+	mockVault.AssertNotCalled(t, "WriteToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// MockVerifyingLinodeClient is a Linode client that can verify new tokens
+type MockVerifyingLinodeClient struct {
+	MockLinodeClient
+}
+
+func (m *MockVerifyingLinodeClient) VerifyToken(ctx context.Context, token *models.Token) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func TestEngine_ProcessToken_VerifiesNewToken(t *testing.T) {
+	mockLinode := new(MockVerifyingLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	// Linode takes a moment to accept the new token
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockLinode.On("VerifyToken", mock.Anything, newToken).Return(linode.ErrTokenNotAccepted).Once()
+	mockLinode.On("VerifyToken", mock.Anything, newToken).Return(nil).Once()
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: 123, RotationCount: 2}, nil)
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return(newToken.Token, nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.CurrentLinodeID == 456 && state.DeliveredLinodeID == 456 && state.RotationCount == 3
+	})).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+	engine.SetVerification(&Verification{Timeout: time.Second, Interval: time.Millisecond})
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_RevokesTokenThatFailsVerification(t *testing.T) {
+	mockLinode := new(MockVerifyingLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockLinode.On("VerifyToken", mock.Anything, newToken).Return(errors.New("new token can't access domains resources"))
+	mockLinode.On("DeleteToken", mock.Anything, newToken.ID).Return(nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: 123}, nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+	engine.SetVerification(&Verification{Timeout: time.Second, Interval: time.Millisecond})
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't access domains resources")
+
+	// Scope errors aren't retried, and the previous token stays in place
+	mockLinode.AssertNumberOfCalls(t, "VerifyToken", 1)
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertNotCalled(t, "WriteToken", mock.Anything, mock.Anything, mock.Anything)
+	mockVault.AssertNotCalled(t, "WriteTokenState", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestEngine_ProcessToken_ReadBackMismatch(t *testing.T) {
+	mockLinode := new(MockVerifyingLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "*", mock.Anything).Return(newToken, nil)
+	mockLinode.On("VerifyToken", mock.Anything, newToken).Return(nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: 123, DeliveredLinodeID: 123, RotationCount: 2}, nil)
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("ReadToken", mock.Anything, path).Return("corrupted-token", nil)
+	// The rotation isn't counted until the token is redelivered
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.MatchedBy(func(state *models.TokenState) bool {
+		return state.CurrentLinodeID == 456 && state.DeliveredLinodeID == 123 && state.RotationCount == 2
+	})).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+	engine.SetVerification(&Verification{Timeout: time.Second, Interval: time.Millisecond})
+
+	err := engine.ProcessToken(context.Background(), tokenConfig, 10)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "vault:"+path+": token read back doesn't match the token written")
+
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_RotatesOnScopeDrift(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, newToken := rotationFixture()
+	path := tokenConfig.Storage[0].Path
+
+	// The token has plenty of validity left, but more access than configured now
+	tokenConfig.Scopes = "linodes:read_only"
+	current.Scopes = "*"
+	current.CreatedAt = time.Now().Add(-time.Hour)
+	current.ExpiresAt = time.Now().Add(89 * 24 * time.Hour)
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+	mockLinode.On("CreateToken", mock.Anything, tokenConfig.Label, "linodes:read_only", mock.Anything).Return(newToken, nil)
+	mockVault.On("ReadTokenState", mock.Anything, path).Return(&models.TokenState{CurrentLinodeID: current.ID}, nil)
+	mockVault.On("WriteToken", mock.Anything, path, newToken.Token).Return(nil)
+	mockVault.On("WriteTokenState", mock.Anything, path, mock.Anything).Return(nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	mockLinode.AssertExpectations(t)
+	mockVault.AssertExpectations(t)
+}
+
+func TestEngine_ProcessToken_ScopeOrderIsIgnored(t *testing.T) {
+	mockLinode := new(MockLinodeClient)
+	mockVault := new(MockVaultClient)
+	tokenConfig, current, _ := rotationFixture()
+
+	tokenConfig.Scopes = "linodes:read_only, domains:read_write"
+	current.Scopes = "domains:read_write,linodes:read_only"
+	current.CreatedAt = time.Now().Add(-time.Hour)
+	current.ExpiresAt = time.Now().Add(89 * 24 * time.Hour)
+
+	mockLinode.On("FindTokenByLabel", mock.Anything, tokenConfig.Label).Return(current, nil)
+
+	engine := NewEngine(mockLinode, mockVault, storage.NewDefaultRegistry(mockVault, nil), false)
+
+	require.NoError(t, engine.ProcessToken(context.Background(), tokenConfig, 10))
+
+	mockLinode.AssertNotCalled(t, "CreateToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
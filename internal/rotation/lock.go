@@ -0,0 +1,122 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/leader"
+	"github.com/wbh1/latr/internal/observability"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// lockReleaseTimeout bounds releasing a token lock after the rotation context is done
+const lockReleaseTimeout = 10 * time.Second
+
+// TokenLocks configures the per-token locks taken around rotation
+type TokenLocks struct {
+	Locker        leader.Locker
+	Identity      string        // Lock holder identity, unique per process
+	LeaseDuration time.Duration // How long a lock is held without being renewed
+}
+
+// SetTokenLocks makes ProcessToken hold a lock on each token while it's processed
+// Without locks, overlapping runs (e.g. a one-shot job and the daemon) could both
+// create a new token for the same label.
+func (e *Engine) SetTokenLocks(locks *TokenLocks) {
+	e.locks = locks
+}
+
+// lockToken takes the lock for tokenConfig and renews it until release is called
+//
+// The returned context is cancelled if the lock is lost, so that the rotation stops
+// before another process can take over. acquired is false while another process
+// holds the lock. A mount that can't hold a lock is an error like any other, since
+// KV v1 mounts are rejected at startup when vault locks are used.
+func (e *Engine) lockToken(ctx context.Context, tokenConfig config.TokenConfig) (lockedCtx context.Context, release func(), acquired bool, err error) {
+	logger := observability.GetLogger()
+
+	tracer := observability.GetTracer()
+	spanCtx, span := tracer.Start(ctx, "AcquireTokenLock")
+	defer span.End()
+
+	lock := e.locks.Locker(tokenConfig)
+	// Vault locks sit next to the token state
+	lockCtx := stateContext(spanCtx, tokenConfig)
+
+	span.SetAttributes(
+		attribute.String("token.label", tokenConfig.Label),
+		attribute.String("lock.name", lock.Describe()),
+		attribute.String("lock.holder", e.locks.Identity),
+	)
+
+	attrs := append([]any{
+		slog.String("token_label", tokenConfig.Label),
+		slog.String("lock", lock.Describe()),
+		slog.String("holder", e.locks.Identity),
+	}, observability.TraceAttrs(spanCtx)...)
+
+	acquired, err = lock.TryAcquire(lockCtx, e.locks.Identity, e.locks.LeaseDuration)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to acquire lock")
+		return nil, nil, false, fmt.Errorf("failed to acquire lock for token %s: %w", tokenConfig.Label, err)
+	}
+	if !acquired {
+		logger.InfoContext(spanCtx, "Token is locked by another process, skipping", attrs...)
+		span.SetStatus(codes.Ok, "held by another process")
+		return nil, nil, false, nil
+	}
+
+	logger.InfoContext(spanCtx, "Acquired token lock", attrs...)
+	span.SetStatus(codes.Ok, "lock acquired")
+
+	lockedCtx, cancel := context.WithCancel(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	// Renew well before the lease lapses, for rotations that outlast it
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(e.locks.LeaseDuration / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				renewed, err := lock.TryAcquire(stateContext(lockedCtx, tokenConfig), e.locks.Identity, e.locks.LeaseDuration)
+				if err != nil || !renewed {
+					attrs := append(attrs, slog.Any("error", err))
+					logger.WarnContext(lockedCtx, "Lost token lock, stopping", attrs...)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	release = func() {
+		close(stop)
+		<-done
+		cancel()
+
+		// The rotation context may be done already
+		releaseCtx, releaseCancel := context.WithTimeout(context.WithoutCancel(lockCtx), lockReleaseTimeout)
+		defer releaseCancel()
+
+		if err := lock.Release(releaseCtx, e.locks.Identity); err != nil {
+			attrs := append(attrs, slog.Any("error", err))
+			logger.WarnContext(ctx, "Failed to release token lock", attrs...)
+			return
+		}
+		logger.InfoContext(ctx, "Released token lock", attrs...)
+	}
+
+	return lockedCtx, release, true, nil
+}
@@ -0,0 +1,212 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/observability"
+	"github.com/wbh1/latr/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// PendingTokenStore keeps tokens that haven't been delivered to every storage backend yet
+// Linode only returns a token's value when it's created, so a failed delivery can only
+// be retried from this copy.
+type PendingTokenStore interface {
+	WritePendingToken(ctx context.Context, path string, token *models.Token) error
+	ReadPendingToken(ctx context.Context, path string) (*models.Token, error)
+	DeletePendingToken(ctx context.Context, path string) error
+}
+
+// pendingStore returns the Vault client as a PendingTokenStore, if it is one
+func (e *Engine) pendingStore() (PendingTokenStore, bool) {
+	store, ok := e.vaultClient.(PendingTokenStore)
+	return store, ok
+}
+
+// savePendingToken keeps a copy of token until it has been delivered
+// Failures are only logged, since delivery may still succeed.
+func (e *Engine) savePendingToken(ctx context.Context, tokenConfig config.TokenConfig, token *models.Token) {
+	store, ok := e.pendingStore()
+	if !ok {
+		return
+	}
+
+	if err := store.WritePendingToken(stateContext(ctx, tokenConfig), tokenConfig.Storage[0].Path, token); err != nil {
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.Int("token_id", token.ID),
+			slog.Any("error", err),
+		}, observability.TraceAttrs(ctx)...)
+		observability.GetLogger().WarnContext(ctx, "Failed to save pending token, a failed delivery can't be retried", attrs...)
+	}
+}
+
+// clearPendingToken removes the pending copy of the token with tokenID
+// A pending token from another run is left alone.
+func (e *Engine) clearPendingToken(ctx context.Context, tokenConfig config.TokenConfig, tokenID int) {
+	store, ok := e.pendingStore()
+	if !ok {
+		return
+	}
+
+	stateCtx := stateContext(ctx, tokenConfig)
+	path := tokenConfig.Storage[0].Path
+
+	pending, err := store.ReadPendingToken(stateCtx, path)
+	if err == nil && (pending == nil || pending.ID != tokenID) {
+		return
+	}
+	if err == nil {
+		err = store.DeletePendingToken(stateCtx, path)
+	}
+	if err != nil {
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.Int("token_id", tokenID),
+			slog.Any("error", err),
+		}, observability.TraceAttrs(ctx)...)
+		observability.GetLogger().WarnContext(ctx, "Failed to clear pending token", attrs...)
+	}
+}
+
+// reconcileToken makes sure the storage backends hold newest, the newest token in Linode
+//
+// A token that an earlier run created but couldn't deliver is redelivered from its
+// pending copy. If the backends are behind and there's no copy, the value can't be
+// recovered from Linode, so needsRotation is returned to replace the token instead.
+func (e *Engine) reconcileToken(ctx context.Context, tokenConfig config.TokenConfig, newest *models.Token) (needsRotation bool, err error) {
+	store, ok := e.pendingStore()
+	if !ok {
+		return false, nil
+	}
+
+	logger := observability.GetLogger()
+	path := tokenConfig.Storage[0].Path
+	stateCtx := stateContext(ctx, tokenConfig)
+
+	pending, err := store.ReadPendingToken(stateCtx, path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read pending token: %w", err)
+	}
+
+	// Superseded by a newer token, or revoked since
+	if pending != nil && pending.ID != newest.ID {
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.Int("pending_token_id", pending.ID),
+			slog.Int("current_token_id", newest.ID),
+			slog.Bool("dry_run", e.dryRun),
+		}, observability.TraceAttrs(ctx)...)
+		logger.InfoContext(ctx, "Discarding stale pending token", attrs...)
+
+		if !e.dryRun {
+			if err := store.DeletePendingToken(stateCtx, path); err != nil {
+				return false, err
+			}
+		}
+		pending = nil
+	}
+
+	state, err := e.vaultClient.ReadTokenState(stateCtx, path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read token state: %w", err)
+	}
+
+	if pending == nil {
+		if state != nil && state.DeliveredLinodeID != 0 && state.DeliveredLinodeID != newest.ID {
+			attrs := append([]any{
+				slog.String("token_label", tokenConfig.Label),
+				slog.Int("delivered_token_id", state.DeliveredLinodeID),
+				slog.Int("current_token_id", newest.ID),
+			}, observability.TraceAttrs(ctx)...)
+			logger.WarnContext(ctx, "Storage backends hold an outdated token that can't be redelivered, rotating", attrs...)
+			return true, nil
+		}
+		return false, nil
+	}
+
+	tracer := observability.GetTracer()
+	ctx, span := tracer.Start(ctx, "RedeliverPendingToken")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("token.label", tokenConfig.Label),
+		attribute.Int("token.id", pending.ID),
+	)
+
+	attrs := append([]any{
+		slog.String("token_label", tokenConfig.Label),
+		slog.Int("token_id", pending.ID),
+		slog.Bool("dry_run", e.dryRun),
+	}, observability.TraceAttrs(ctx)...)
+
+	if e.dryRun {
+		logger.InfoContext(ctx, "DRY RUN: Would redeliver pending token", attrs...)
+		span.SetStatus(codes.Ok, "dry run")
+		return false, nil
+	}
+
+	logger.InfoContext(ctx, "Redelivering pending token", attrs...)
+
+	version := 0
+	// Only the backends that don't hold the token yet are retried
+	skip := make(map[string]bool)
+	if state != nil {
+		version = state.Version
+		for backend, id := range state.Backends {
+			skip[backend] = id == pending.ID
+		}
+	}
+	delivered, deliverErr := e.storeTokenInBackends(ctx, tokenConfig, pending, version, skip)
+	delivered, deliverErr = e.checkDelivery(ctx, tokenConfig, pending.Token, delivered, deliverErr)
+	if delivered == nil {
+		span.RecordError(deliverErr)
+		span.SetStatus(codes.Error, "failed to redeliver token")
+		return false, fmt.Errorf("failed to redeliver pending token: %w", deliverErr)
+	}
+
+	if state == nil {
+		state = &models.TokenState{Label: tokenConfig.Label, LastRotatedAt: time.Now()}
+	}
+	// The run that created the token may have stopped before recording it
+	if state.CurrentLinodeID != pending.ID {
+		state.PreviousLinodeID = state.CurrentLinodeID
+		state.PreviousExpiresAt = time.Time{}
+		state.CurrentLinodeID = pending.ID
+		state.LastRotatedAt = time.Now()
+	}
+	// A rotation counts once every backend holds the new token
+	if delivered.complete() && state.DeliveredLinodeID != pending.ID && state.PreviousLinodeID != 0 {
+		state.RotationCount++
+	}
+	state.DeliveredLinodeID = deliveredID(pending, state, delivered)
+	state.Backends = deliveredBackends(pending, state, delivered)
+
+	if err := e.vaultClient.WriteTokenState(stateCtx, path, state); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to update state")
+		return false, fmt.Errorf("failed to update token state: %w", err)
+	}
+
+	if deliverErr != nil {
+		span.RecordError(deliverErr)
+		span.SetStatus(codes.Error, "failed to redeliver token")
+		return false, fmt.Errorf("failed to redeliver pending token: %w", deliverErr)
+	}
+
+	if err := store.DeletePendingToken(stateCtx, path); err != nil {
+		attrs := append(attrs, slog.Any("error", err))
+		logger.WarnContext(ctx, "Failed to clear pending token", attrs...)
+	}
+
+	e.useNewSelfToken(ctx, tokenConfig, pending.ID, pending.Token)
+
+	logger.InfoContext(ctx, "Redelivered pending token", attrs...)
+	span.SetStatus(codes.Ok, "pending token redelivered")
+	return false, nil
+}
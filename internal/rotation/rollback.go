@@ -0,0 +1,157 @@
+package rotation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/observability"
+	"github.com/wbh1/latr/internal/storage"
+	"github.com/wbh1/latr/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// backendSnapshot is the value a storage backend held before a delivery
+type backendSnapshot struct {
+	backend storage.Storage
+	value   string
+	exists  bool
+	// Set for the first backend when it supports check-and-set: the Linode ID stored
+	// with value, and the version a successful delivery leaves the backend at
+	cas      storage.CASStorage
+	linodeID int
+	version  int
+	// err is why the backend couldn't be read, in which case its previous value is unknown
+	err error
+}
+
+// snapshotBackends reads the value every storage backend holds, so that a failed
+// delivery can be undone. Only storage.ErrNotFound means a backend is empty. Any
+// other read error is kept in the snapshot, and rollbackToken then leaves every
+// backend alone rather than guess what the backend held.
+func (e *Engine) snapshotBackends(ctx context.Context, tokenConfig config.TokenConfig, existingState *models.TokenState) ([]backendSnapshot, error) {
+	snapshots := make([]backendSnapshot, 0, len(tokenConfig.Storage))
+	for i, storageConfig := range tokenConfig.Storage {
+		backend, err := e.storages.New(storageConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot := backendSnapshot{backend: backend}
+		// The delivery writes the first backend with check-and-set against the state's version
+		if cas, ok := backend.(storage.CASStorage); ok && i == 0 {
+			snapshot.cas = cas
+			if existingState != nil {
+				snapshot.version = existingState.Version
+			}
+			snapshot.version++
+		}
+
+		snapshot.value, err = backend.Read(ctx)
+		if err == nil && snapshot.cas != nil {
+			snapshot.linodeID, err = snapshot.cas.ReadLinodeID(ctx)
+		}
+		switch {
+		case err == nil:
+			snapshot.exists = true
+		case !errors.Is(err, storage.ErrNotFound):
+			snapshot.err = err
+
+			attrs := append([]any{
+				slog.String("token_label", tokenConfig.Label),
+				slog.String("storage", backend.Describe()),
+				slog.Any("error", err),
+			}, observability.TraceAttrs(ctx)...)
+			observability.GetLogger().WarnContext(ctx, "Failed to read storage before rotation, a failed delivery won't be rolled back", attrs...)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// rollbackToken undoes a failed delivery of newToken
+//
+// Backends that already received newToken get their previous value written back
+// (or lose the key if they had none), then newToken is revoked in Linode. On KV v2
+// a delete only hides the latest version, so a previous value is always restored by
+// writing it. The first backend gets its Linode ID back too, with a check-and-set
+// against the version the delivery left it at. The token state isn't touched, so the
+// failed rotation leaves no trace.
+// If a backend can't be restored, or one couldn't be read beforehand, newToken is
+// kept since a backend may depend on it.
+func (e *Engine) rollbackToken(ctx context.Context, tokenConfig config.TokenConfig, newToken *models.Token, snapshots []backendSnapshot) error {
+	logger := observability.GetLogger()
+
+	tracer := observability.GetTracer()
+	ctx, span := tracer.Start(ctx, "RollbackToken")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("token.label", tokenConfig.Label),
+		attribute.Int("token.id", newToken.ID),
+	)
+
+	// Without every previous value, restoring could destroy a token still in use
+	var errs []error
+	for _, snapshot := range snapshots {
+		if snapshot.err != nil {
+			errs = append(errs, fmt.Errorf("previous value of %s is unknown: %w", snapshot.backend.Describe(), snapshot.err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "storage wasn't snapshotted")
+		return err
+	}
+
+	for _, snapshot := range snapshots {
+		current, err := snapshot.backend.Read(ctx)
+		if err != nil || current != newToken.Token {
+			continue
+		}
+
+		switch {
+		case snapshot.exists && snapshot.cas != nil:
+			err = snapshot.cas.WriteCAS(ctx, snapshot.value, snapshot.linodeID, snapshot.version)
+		case snapshot.exists:
+			err = snapshot.backend.Write(ctx, snapshot.value)
+		default:
+			err = snapshot.backend.Delete(ctx)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", snapshot.backend.Describe(), err))
+			continue
+		}
+
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.String("storage", snapshot.backend.Describe()),
+		}, observability.TraceAttrs(ctx)...)
+		logger.InfoContext(ctx, "Restored previous token in storage", attrs...)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to restore storage")
+		return err
+	}
+
+	if err := e.linodeFor(tokenConfig).DeleteToken(ctx, newToken.ID); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to delete token")
+		return fmt.Errorf("failed to delete token %d: %w", newToken.ID, err)
+	}
+	e.clearPendingToken(ctx, tokenConfig, newToken.ID)
+
+	attrs := append([]any{
+		slog.String("token_label", tokenConfig.Label),
+		slog.Int("token_id", newToken.ID),
+	}, observability.TraceAttrs(ctx)...)
+	logger.InfoContext(ctx, "Rolled back token after storage failure", attrs...)
+
+	span.SetStatus(codes.Ok, "rolled back")
+	return nil
+}
@@ -0,0 +1,47 @@
+package rotation
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/observability"
+)
+
+// TokenSwapper is implemented by Linode clients whose token can be replaced while running
+type TokenSwapper interface {
+	SetToken(token string)
+}
+
+// SetSelfToken marks the token with label as the one the named account's Linode client uses
+// Once a new token for that label has been delivered to every storage backend, the
+// client is switched to it, so latr keeps working after its own token is rotated.
+func (e *Engine) SetSelfToken(account, label string) {
+	if e.selfTokens == nil {
+		e.selfTokens = make(map[string]string)
+	}
+	e.selfTokens[account] = label
+}
+
+// useNewSelfToken switches the Linode client to token if tokenConfig is latr's own token
+// for the client's account
+func (e *Engine) useNewSelfToken(ctx context.Context, tokenConfig config.TokenConfig, tokenID int, token string) {
+	label, ok := e.selfTokens[tokenConfig.AccountName()]
+	if !ok || tokenConfig.Label != label || e.dryRun {
+		return
+	}
+
+	attrs := append([]any{
+		slog.String("token_label", tokenConfig.Label),
+		slog.Int("token_id", tokenID),
+	}, observability.TraceAttrs(ctx)...)
+
+	swapper, ok := e.linodeFor(tokenConfig).(TokenSwapper)
+	if !ok {
+		observability.GetLogger().WarnContext(ctx, "Linode client can't switch tokens, restart latr to use the new token", attrs...)
+		return
+	}
+
+	swapper.SetToken(token)
+	observability.GetLogger().InfoContext(ctx, "Switched the Linode client to latr's new token", attrs...)
+}
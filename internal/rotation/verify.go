@@ -0,0 +1,157 @@
+package rotation
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/linode"
+	"github.com/wbh1/latr/internal/observability"
+	"github.com/wbh1/latr/internal/storage"
+	"github.com/wbh1/latr/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// defaultVerifyInterval is how often a token that Linode doesn't accept yet is checked again
+const defaultVerifyInterval = 5 * time.Second
+
+// TokenVerifier checks a new token against the Linode API
+// VerifyToken returns an error wrapping linode.ErrTokenNotAccepted while the token isn't
+// accepted, which may just be propagation lag.
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token *models.Token) error
+}
+
+// Verification configures the checks made on a new token before a rotation counts as successful
+type Verification struct {
+	Timeout  time.Duration // How long to wait for Linode to accept a new token
+	Interval time.Duration // How often to check again while it doesn't, defaults to 5s
+}
+
+// SetVerification makes the engine verify every new token
+// The token has to be accepted by the Linode API before it's delivered, and every storage
+// backend has to return it when read back before the rotation is recorded as successful.
+func (e *Engine) SetVerification(verification *Verification) {
+	e.verification = verification
+}
+
+// verifyToken checks that Linode accepts newToken, waiting up to the configured timeout
+func (e *Engine) verifyToken(ctx context.Context, tokenConfig config.TokenConfig, newToken *models.Token) error {
+	verifier, ok := e.linodeFor(tokenConfig).(TokenVerifier)
+	if !ok {
+		return nil
+	}
+
+	tracer := observability.GetTracer()
+	ctx, span := tracer.Start(ctx, "VerifyToken")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("token.label", tokenConfig.Label),
+		attribute.Int("token.id", newToken.ID),
+	)
+
+	interval := e.verification.Interval
+	if interval <= 0 {
+		interval = defaultVerifyInterval
+	}
+	deadline := time.Now().Add(e.verification.Timeout)
+
+	for attempt := 1; ; attempt++ {
+		err := verifier.VerifyToken(ctx, newToken)
+		if err == nil {
+			span.SetAttributes(attribute.Int("verify.attempts", attempt))
+			span.SetStatus(codes.Ok, "token verified")
+			return nil
+		}
+		if !errors.Is(err, linode.ErrTokenNotAccepted) || time.Now().Add(interval).After(deadline) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "token verification failed")
+			return fmt.Errorf("failed to verify token %s: %w", tokenConfig.Label, err)
+		}
+
+		attrs := append([]any{
+			slog.String("token_label", tokenConfig.Label),
+			slog.Int("token_id", newToken.ID),
+			slog.Int("attempt", attempt),
+		}, observability.TraceAttrs(ctx)...)
+		observability.GetLogger().InfoContext(ctx, "New token is not accepted yet, retrying", attrs...)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// verifyDelivery reads token back from every backend that received it and compares hashes
+// Backends returning something else are marked as not delivered in the returned delivery,
+// and reported in a *DeliveryError.
+func (e *Engine) verifyDelivery(ctx context.Context, tokenConfig config.TokenConfig, token string, delivered delivery) (delivery, error) {
+	tracer := observability.GetTracer()
+	ctx, span := tracer.Start(ctx, "VerifyDelivery")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("token.label", tokenConfig.Label))
+
+	want := sha256.Sum256([]byte(token))
+	verified := make(delivery, len(delivered))
+	var failed []BackendFailure
+	for _, storageConfig := range tokenConfig.Storage {
+		backend, err := e.storages.New(storageConfig)
+		if err != nil {
+			return delivered, err
+		}
+		key := backendKey(backend)
+		if !delivered[key] {
+			verified[key] = false
+			continue
+		}
+
+		err = compareStoredToken(ctx, backend, want)
+		if err != nil {
+			verified[key] = false
+			failed = append(failed, BackendFailure{Backend: backend.Describe(), Err: err})
+			observability.RecordStorageError(ctx, tokenConfig.Label, storageConfig.Type, storageConfig.Path, backend.Describe())
+
+			attrs := append([]any{
+				slog.String("token_label", tokenConfig.Label),
+				slog.String("storage", backend.Describe()),
+				slog.Any("error", err),
+			}, observability.TraceAttrs(ctx)...)
+			observability.GetLogger().ErrorContext(ctx, "Stored token doesn't match", attrs...)
+			continue
+		}
+		verified[key] = true
+	}
+
+	if len(failed) > 0 {
+		err := &DeliveryError{Failed: failed, Total: len(tokenConfig.Storage)}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "stored token doesn't match")
+		return verified, err
+	}
+
+	span.SetStatus(codes.Ok, "delivery verified")
+	return verified, nil
+}
+
+// compareStoredToken reads backend and checks that the hash of its value is want
+func compareStoredToken(ctx context.Context, backend storage.Storage, want [sha256.Size]byte) error {
+	value, err := backend.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read token back: %w", err)
+	}
+	got := sha256.Sum256([]byte(value))
+	if subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+		return errors.New("token read back doesn't match the token written")
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/wbh1/latr/internal/leader"
+	"github.com/wbh1/latr/internal/observability"
+)
+
+// releaseTimeout bounds releasing the leader lock on shutdown
+const releaseTimeout = 10 * time.Second
+
+// LeaderElection configures leader election between scheduler replicas
+type LeaderElection struct {
+	Lock          leader.Lock
+	Identity      string        // Lock holder identity, unique per replica
+	LeaseDuration time.Duration // How long the lock is held without being renewed
+	RenewInterval time.Duration // How often the leader renews and standbys retry
+}
+
+// SetLeaderElection makes the scheduler only run rotation cycles while it holds the lock
+func (s *Scheduler) SetLeaderElection(election *LeaderElection) {
+	s.election = election
+}
+
+// IsLeader reports whether this replica currently holds the leader lock
+// Without leader election every replica is its own leader.
+func (s *Scheduler) IsLeader() bool {
+	if s.election == nil {
+		return true
+	}
+	return s.leaderContext() != nil
+}
+
+// runElected runs rotation cycles at interval while this replica is the leader
+//
+// Leadership is campaigned for in the background so that the lock keeps being
+// renewed while a cycle runs. A cycle is started as soon as leadership is won,
+// and losing it cancels the cycle in progress.
+func (s *Scheduler) runElected(ctx context.Context, interval time.Duration) error {
+	logger := observability.GetLogger()
+	attrs := append([]any{
+		slog.String("lock", s.election.Lock.Describe()),
+		slog.String("identity", s.election.Identity),
+	}, observability.TraceAttrs(ctx)...)
+	logger.InfoContext(ctx, "Leader election enabled", attrs...)
+
+	elected := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.campaign(ctx, elected)
+	}()
+	// Wait for the lock to be released before returning
+	defer func() { <-done }()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			attrs := append([]any{slog.Any("reason", ctx.Err())}, observability.TraceAttrs(ctx)...)
+			logger.InfoContext(ctx, "Shutting down scheduler", attrs...)
+			return ctx.Err()
+		case <-elected:
+			s.executeLeaderCycle(ctx)
+		case <-ticker.C:
+			s.executeLeaderCycle(ctx)
+		}
+	}
+}
+
+// executeLeaderCycle runs a rotation cycle if this replica is the leader
+func (s *Scheduler) executeLeaderCycle(ctx context.Context) {
+	logger := observability.GetLogger()
+
+	leaderCtx := s.leaderContext()
+	if leaderCtx == nil {
+		attrs := append([]any{slog.String("identity", s.election.Identity)}, observability.TraceAttrs(ctx)...)
+		logger.DebugContext(ctx, "Not the leader, skipping rotation cycle", attrs...)
+		return
+	}
+
+	if err := s.executeCycle(leaderCtx); err != nil {
+		attrs := append([]any{slog.Any("error", err)}, observability.TraceAttrs(ctx)...)
+		logger.ErrorContext(ctx, "Error in rotation cycle", attrs...)
+	}
+}
+
+// lead makes this replica the leader once it has acquired the lock at acquired, and keeps
+// the lock renewed in the background with the same loop standbys campaign with. The
+// returned context is cancelled if the lock is lost. stop ends the renewals and releases
+// the lock.
+func (s *Scheduler) lead(ctx context.Context, acquired time.Time) (leaderCtx context.Context, stop func()) {
+	s.leaderMu.Lock()
+	s.leaderCtx, s.leaderCancel = context.WithCancel(ctx)
+	s.leaderRenewed = acquired
+	leaderCtx = s.leaderCtx
+	s.leaderMu.Unlock()
+
+	campaignCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.campaign(campaignCtx, make(chan struct{}, 1))
+	}()
+
+	return leaderCtx, func() {
+		cancel()
+		<-done
+	}
+}
+
+// campaign tries to acquire or renew the lock every renew interval until ctx is done
+func (s *Scheduler) campaign(ctx context.Context, elected chan<- struct{}) {
+	ticker := time.NewTicker(s.election.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		s.tryLead(ctx, elected)
+
+		select {
+		case <-ctx.Done():
+			s.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryLead acquires or renews the lock and updates leadership accordingly
+// A leader steps down as soon as another replica holds the lock. A failed renewal is
+// retried while the lease is still held, and only counts as losing the lock once the
+// lease could lapse before the next attempt.
+func (s *Scheduler) tryLead(ctx context.Context, elected chan<- struct{}) {
+	logger := observability.GetLogger()
+
+	// The lease runs from before the request, as the lock may be granted at any point during it
+	attempted := time.Now()
+	acquired, err := s.election.Lock.TryAcquire(ctx, s.election.Identity, s.election.LeaseDuration)
+	if err != nil && ctx.Err() == nil {
+		attrs := append([]any{
+			slog.String("lock", s.election.Lock.Describe()),
+			slog.Any("error", err),
+		}, observability.TraceAttrs(ctx)...)
+		logger.WarnContext(ctx, "Failed to acquire leader lock", attrs...)
+	}
+
+	s.leaderMu.Lock()
+	defer s.leaderMu.Unlock()
+
+	attrs := append([]any{
+		slog.String("lock", s.election.Lock.Describe()),
+		slog.String("identity", s.election.Identity),
+	}, observability.TraceAttrs(ctx)...)
+
+	switch {
+	case acquired && s.leaderCancel == nil:
+		s.leaderCtx, s.leaderCancel = context.WithCancel(ctx)
+		s.leaderRenewed = attempted
+		logger.InfoContext(ctx, "Acquired leadership", attrs...)
+		select {
+		case elected <- struct{}{}:
+		default:
+		}
+	case acquired:
+		s.leaderRenewed = attempted
+	case s.leaderCancel != nil && err != nil && !s.leaseLapsing():
+		// The lease is still held, and the next attempt may renew it in time
+	case s.leaderCancel != nil:
+		s.leaderCancel()
+		s.leaderCtx, s.leaderCancel = nil, nil
+		logger.WarnContext(ctx, "Lost leadership", attrs...)
+	}
+}
+
+// release steps down and releases the lock, so a standby can take over without waiting for the lease to lapse
+func (s *Scheduler) release() {
+	s.leaderMu.Lock()
+	if s.leaderCancel != nil {
+		s.leaderCancel()
+		s.leaderCtx, s.leaderCancel = nil, nil
+	}
+	s.leaderMu.Unlock()
+
+	// The scheduler's context is usually cancelled by now
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := s.election.Lock.Release(ctx, s.election.Identity); err != nil {
+		attrs := []any{
+			slog.String("lock", s.election.Lock.Describe()),
+			slog.Any("error", err),
+		}
+		observability.GetLogger().WarnContext(ctx, "Failed to release leader lock", attrs...)
+	}
+}
+
+// leaseLapsing reports whether the lease may lapse before the next renewal attempt
+// Must be called with leaderMu held.
+func (s *Scheduler) leaseLapsing() bool {
+	return time.Since(s.leaderRenewed) >= s.election.LeaseDuration-s.election.RenewInterval
+}
+
+// leaderContext returns the context of the current leadership term, or nil when not the leader
+func (s *Scheduler) leaderContext() context.Context {
+	s.leaderMu.Lock()
+	defer s.leaderMu.Unlock()
+	return s.leaderCtx
+}
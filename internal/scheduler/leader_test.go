@@ -0,0 +1,230 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/leader"
+)
+
+// countingEngine counts the tokens it was asked to process
+type countingEngine struct {
+	processed atomic.Int32
+}
+
+func (e *countingEngine) ProcessToken(ctx context.Context, tokenConfig config.TokenConfig, thresholdPercent int) error {
+	e.processed.Add(1)
+	return nil
+}
+
+func electionConfig(mode string) *config.Config {
+	return &config.Config{
+		Daemon: config.DaemonConfig{
+			Mode:          mode,
+			CheckInterval: "50ms",
+		},
+		Rotation: config.RotationConfig{
+			ThresholdPercent: 10,
+		},
+		Tokens: []config.TokenConfig{
+			{Label: "token1", Team: "team1", Validity: "90d", Scopes: "*", Storage: []config.StorageConfig{{Type: "vault", Path: "path1"}}},
+		},
+	}
+}
+
+func newElectedScheduler(cfg *config.Config, engine Engine, lock leader.Lock, identity string) *Scheduler {
+	s := NewScheduler(cfg, engine)
+	s.SetLeaderElection(&LeaderElection{
+		Lock:          lock,
+		Identity:      identity,
+		LeaseDuration: 300 * time.Millisecond,
+		RenewInterval: 50 * time.Millisecond,
+	})
+	return s
+}
+
+func TestScheduler_LeaderElection_OnlyLeaderRuns(t *testing.T) {
+	lock := leader.NewFile(filepath.Join(t.TempDir(), "leader.lock"))
+	cfg := electionConfig("daemon")
+
+	engineA := &countingEngine{}
+	schedulerA := newElectedScheduler(cfg, engineA, lock, "replica-a")
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := make(chan error, 1)
+	go func() { doneA <- schedulerA.Run(ctxA) }()
+
+	require.Eventually(t, func() bool { return engineA.processed.Load() > 0 }, time.Second, 10*time.Millisecond)
+	assert.True(t, schedulerA.IsLeader())
+
+	engineB := &countingEngine{}
+	schedulerB := newElectedScheduler(cfg, engineB, lock, "replica-b")
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	doneB := make(chan error, 1)
+	go func() { doneB <- schedulerB.Run(ctxB) }()
+
+	// The standby never runs a cycle while the leader keeps renewing
+	time.Sleep(500 * time.Millisecond)
+	assert.Zero(t, engineB.processed.Load())
+	assert.False(t, schedulerB.IsLeader())
+
+	// Shutting down releases the lock, so the standby takes over
+	cancelA()
+	assert.ErrorIs(t, <-doneA, context.Canceled)
+	assert.False(t, schedulerA.IsLeader())
+
+	require.Eventually(t, func() bool { return engineB.processed.Load() > 0 }, time.Second, 10*time.Millisecond)
+	assert.True(t, schedulerB.IsLeader())
+
+	cancelB()
+	assert.ErrorIs(t, <-doneB, context.Canceled)
+}
+
+func TestScheduler_LeaderElection_TakesOverLapsedLease(t *testing.T) {
+	lock := leader.NewFile(filepath.Join(t.TempDir(), "leader.lock"))
+
+	// A replica that crashed without releasing the lock
+	acquired, err := lock.TryAcquire(context.Background(), "crashed", 200*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	engine := &countingEngine{}
+	scheduler := newElectedScheduler(electionConfig("daemon"), engine, lock, "replica-a")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- scheduler.Run(ctx) }()
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Zero(t, engine.processed.Load())
+
+	require.Eventually(t, func() bool { return engine.processed.Load() > 0 }, time.Second, 10*time.Millisecond)
+
+	// Wait for the lock to be released before the temp dir is removed
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestScheduler_LeaderElection_OneShotSkipsWhenNotLeader(t *testing.T) {
+	lock := leader.NewFile(filepath.Join(t.TempDir(), "leader.lock"))
+
+	acquired, err := lock.TryAcquire(context.Background(), "replica-b", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	engine := &countingEngine{}
+	scheduler := newElectedScheduler(electionConfig("one-shot"), engine, lock, "replica-a")
+	require.NoError(t, scheduler.Run(context.Background()))
+	assert.Zero(t, engine.processed.Load())
+
+	// Once released, the one-shot run goes ahead and releases the lock afterwards
+	require.NoError(t, lock.Release(context.Background(), "replica-b"))
+	require.NoError(t, scheduler.Run(context.Background()))
+	assert.Equal(t, int32(1), engine.processed.Load())
+
+	acquired, err = lock.TryAcquire(context.Background(), "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+// expiringLock grants the lock once, then fails every renewal
+type expiringLock struct {
+	attempts atomic.Int32
+	released atomic.Bool
+}
+
+func (l *expiringLock) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	if l.attempts.Add(1) == 1 {
+		return true, nil
+	}
+	return false, errors.New("vault sealed")
+}
+
+func (l *expiringLock) Release(ctx context.Context, holder string) error {
+	l.released.Store(true)
+	return nil
+}
+
+func (l *expiringLock) Describe() string { return "expiring" }
+
+// blockingEngine processes tokens until the cycle is cancelled
+type blockingEngine struct {
+	processed atomic.Int32
+}
+
+func (e *blockingEngine) ProcessToken(ctx context.Context, tokenConfig config.TokenConfig, thresholdPercent int) error {
+	e.processed.Add(1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(5 * time.Second):
+		return nil
+	}
+}
+
+func TestScheduler_LeaderElection_OneShotAbortsWhenRenewalFails(t *testing.T) {
+	cfg := electionConfig("one-shot")
+	cfg.Tokens = append(cfg.Tokens, config.TokenConfig{Label: "token2", Team: "team1", Validity: "90d", Scopes: "*", Storage: []config.StorageConfig{{Type: "vault", Path: "path2"}}})
+
+	lock := &expiringLock{}
+	engine := &blockingEngine{}
+	scheduler := newElectedScheduler(cfg, engine, lock, "replica-a")
+
+	// The lease is renewed during the cycle, and once renewals have failed for most of the
+	// lease the cycle is stopped before the next token
+	err := scheduler.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lost the leader lock")
+	assert.Equal(t, int32(1), engine.processed.Load())
+	assert.GreaterOrEqual(t, lock.attempts.Load(), int32(2))
+	assert.True(t, lock.released.Load())
+	assert.False(t, scheduler.IsLeader())
+}
+
+// flakyLock grants the lock, but fails the first renewal
+type flakyLock struct {
+	attempts atomic.Int32
+}
+
+func (l *flakyLock) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	if l.attempts.Add(1) == 2 {
+		return false, errors.New("connection reset")
+	}
+	return true, nil
+}
+
+func (l *flakyLock) Release(ctx context.Context, holder string) error { return nil }
+
+func (l *flakyLock) Describe() string { return "flaky" }
+
+// slowEngine takes a while to process each token, unless the cycle is cancelled
+type slowEngine struct {
+	processed atomic.Int32
+}
+
+func (e *slowEngine) ProcessToken(ctx context.Context, tokenConfig config.TokenConfig, thresholdPercent int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(200 * time.Millisecond):
+		e.processed.Add(1)
+		return nil
+	}
+}
+
+func TestScheduler_LeaderElection_OneShotSurvivesFailedRenewal(t *testing.T) {
+	lock := &flakyLock{}
+	engine := &slowEngine{}
+	scheduler := newElectedScheduler(electionConfig("one-shot"), engine, lock, "replica-a")
+
+	// The lease is still held after the failed renewal, so the cycle isn't cancelled
+	require.NoError(t, scheduler.Run(context.Background()))
+	assert.Equal(t, int32(1), engine.processed.Load())
+	assert.GreaterOrEqual(t, lock.attempts.Load(), int32(3))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/wbh1/latr/internal/config"
@@ -17,10 +18,23 @@ type Engine interface {
 	ProcessToken(ctx context.Context, tokenConfig config.TokenConfig, thresholdPercent int) error
 }
 
+// TokenRefresher re-reads the Linode API token, which may have changed since the last cycle
+type TokenRefresher interface {
+	RefreshToken(ctx context.Context) error
+}
+
 // Scheduler manages the execution schedule for token rotation
 type Scheduler struct {
-	config *config.Config
-	engine Engine
+	config    *config.Config
+	engine    Engine
+	election  *LeaderElection
+	refresher TokenRefresher
+
+	// Set while this replica is the leader, and cancelled when leadership is lost
+	leaderMu      sync.Mutex
+	leaderCtx     context.Context
+	leaderCancel  context.CancelFunc
+	leaderRenewed time.Time // When the lock was last acquired or renewed
 }
 
 // NewScheduler creates a new scheduler
@@ -31,6 +45,11 @@ func NewScheduler(cfg *config.Config, engine Engine) *Scheduler {
 	}
 }
 
+// SetTokenRefresher makes the scheduler refresh the Linode API token before each cycle
+func (s *Scheduler) SetTokenRefresher(refresher TokenRefresher) {
+	s.refresher = refresher
+}
+
 // Run starts the scheduler based on the configured mode
 func (s *Scheduler) Run(ctx context.Context) error {
 	if s.config.Daemon.Mode == "one-shot" {
@@ -44,6 +63,30 @@ func (s *Scheduler) runOnce(ctx context.Context) error {
 	logger := observability.GetLogger()
 	attrs := observability.TraceAttrs(ctx)
 	logger.InfoContext(ctx, "Running in one-shot mode", attrs...)
+
+	if s.election != nil {
+		attempted := time.Now()
+		acquired, err := s.election.Lock.TryAcquire(ctx, s.election.Identity, s.election.LeaseDuration)
+		if err != nil {
+			return fmt.Errorf("failed to acquire leader lock: %w", err)
+		}
+		if !acquired {
+			attrs := append([]any{slog.String("lock", s.election.Lock.Describe())}, observability.TraceAttrs(ctx)...)
+			logger.InfoContext(ctx, "Another replica holds the leader lock, skipping rotation cycle", attrs...)
+			return nil
+		}
+
+		// The lease must outlive the cycle, which is aborted if the lock is lost
+		leaderCtx, stop := s.lead(ctx, attempted)
+		defer stop()
+
+		err = s.executeCycle(leaderCtx)
+		if err != nil && leaderCtx.Err() != nil && ctx.Err() == nil {
+			return fmt.Errorf("lost the leader lock: %w", err)
+		}
+		return err
+	}
+
 	return s.executeCycle(ctx)
 }
 
@@ -58,6 +101,10 @@ func (s *Scheduler) runDaemon(ctx context.Context) error {
 		return fmt.Errorf("invalid check interval: %w", err)
 	}
 
+	if s.election != nil {
+		return s.runElected(ctx, interval)
+	}
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -108,8 +155,24 @@ func (s *Scheduler) executeCycle(ctx context.Context) error {
 		return nil
 	}
 
+	// The previous token keeps being used if the new one can't be read
+	if s.refresher != nil {
+		if err := s.refresher.RefreshToken(ctx); err != nil {
+			span.RecordError(err)
+			attrs := append([]any{slog.Any("error", err)}, observability.TraceAttrs(ctx)...)
+			logger.WarnContext(ctx, "Failed to refresh Linode token, keeping the current one", attrs...)
+		}
+	}
+
 	// Process each token
 	for _, tokenConfig := range s.config.Tokens {
+		// Leadership was lost or the scheduler is shutting down
+		if err := ctx.Err(); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "rotation cycle aborted")
+			return fmt.Errorf("rotation cycle aborted: %w", err)
+		}
+
 		// Determine threshold (use token-specific if set, otherwise global)
 		threshold := s.config.Rotation.ThresholdPercent
 		if tokenConfig.RotationThreshold > 0 {
@@ -119,6 +182,7 @@ func (s *Scheduler) executeCycle(ctx context.Context) error {
 		if err := s.engine.ProcessToken(ctx, tokenConfig, threshold); err != nil {
 			attrs := append([]any{
 				slog.String("token_label", tokenConfig.Label),
+				slog.String("account", tokenConfig.AccountName()),
 				slog.Any("error", err),
 			}, observability.TraceAttrs(ctx)...)
 			logger.ErrorContext(ctx, "Failed to process token", attrs...)
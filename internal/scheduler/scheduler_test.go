@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -194,3 +195,45 @@ func TestScheduler_NoTokensConfigured(t *testing.T) {
 	// ProcessToken should not be called
 	mockEngine.AssertNotCalled(t, "ProcessToken")
 }
+
+// MockTokenRefresher is a mock of the Linode client's token refresh
+type MockTokenRefresher struct {
+	mock.Mock
+}
+
+func (m *MockTokenRefresher) RefreshToken(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func TestScheduler_RefreshesTokenBeforeCycle(t *testing.T) {
+	mockEngine := new(MockEngine)
+	mockRefresher := new(MockTokenRefresher)
+
+	cfg := &config.Config{
+		Daemon: config.DaemonConfig{
+			Mode: "one-shot",
+		},
+		Rotation: config.RotationConfig{
+			ThresholdPercent: 10,
+		},
+		Tokens: []config.TokenConfig{
+			{Label: "token1", Validity: "90d", Scopes: "*", Storage: []config.StorageConfig{{Type: "vault", Path: "path1"}}},
+		},
+	}
+
+	var order []string
+	mockRefresher.On("RefreshToken", mock.Anything).Return(errors.New("vault sealed")).Run(func(mock.Arguments) {
+		order = append(order, "refresh")
+	})
+	mockEngine.On("ProcessToken", mock.Anything, cfg.Tokens[0], 10).Return(nil).Run(func(mock.Arguments) {
+		order = append(order, "process")
+	})
+
+	scheduler := NewScheduler(cfg, mockEngine)
+	scheduler.SetTokenRefresher(mockRefresher)
+
+	// Tokens are still processed with the current Linode token if refreshing it fails
+	require.NoError(t, scheduler.Run(context.Background()))
+	assert.Equal(t, []string{"refresh", "process"}, order)
+}
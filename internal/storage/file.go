@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/file"
+)
+
+// File stores tokens in a local file
+type File struct {
+	path string
+	opts file.Options
+}
+
+// NewFile creates file storage from its configuration
+func NewFile(cfg config.StorageConfig) (Storage, error) {
+	var opts config.FileStorageOptions
+	if err := cfg.DecodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	mode, err := file.ParseMode(opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := file.ValidateFormat(opts.Format); err != nil {
+		return nil, err
+	}
+
+	return &File{
+		path: cfg.Path,
+		opts: file.Options{
+			Mode:   mode,
+			Owner:  opts.Owner,
+			Format: opts.Format,
+			Key:    opts.Key,
+		},
+	}, nil
+}
+
+// Write atomically writes the token to the file
+func (f *File) Write(ctx context.Context, token string) error {
+	return file.WriteToken(f.path, token, f.opts)
+}
+
+// Read returns the token stored in the file
+func (f *File) Read(ctx context.Context) (string, error) {
+	token, err := file.ReadToken(f.path, f.opts)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return token, err
+}
+
+// Delete removes the file
+func (f *File) Delete(ctx context.Context) error {
+	if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete token file: %w", err)
+	}
+	return nil
+}
+
+// Describe returns the file path
+func (f *File) Describe() string {
+	return "file:" + f.path
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/kubernetes"
+)
+
+// defaultSecretKey is the Secret data key used when none is configured
+const defaultSecretKey = "token"
+
+// KubernetesClient defines the Kubernetes Secret operations used by kubernetes storage
+type KubernetesClient interface {
+	WriteSecretKey(ctx context.Context, namespace, name, key, value string) error
+	ReadSecretKey(ctx context.Context, namespace, name, key string) (string, error)
+	DeleteSecretKey(ctx context.Context, namespace, name, key string) error
+}
+
+// Kubernetes stores tokens in a key of a Kubernetes Secret
+type Kubernetes struct {
+	client    KubernetesClient
+	namespace string
+	name      string
+	key       string
+}
+
+// NewKubernetesFactory returns a Factory that creates kubernetes storage using client
+func NewKubernetesFactory(client KubernetesClient) Factory {
+	return func(cfg config.StorageConfig) (Storage, error) {
+		if client == nil {
+			return nil, fmt.Errorf("no kubernetes client is available")
+		}
+
+		var opts config.KubernetesStorageOptions
+		if err := cfg.DecodeOptions(&opts); err != nil {
+			return nil, err
+		}
+
+		key := opts.Key
+		if key == "" {
+			key = defaultSecretKey
+		}
+
+		return &Kubernetes{
+			client:    client,
+			namespace: opts.Namespace,
+			name:      cfg.Path,
+			key:       key,
+		}, nil
+	}
+}
+
+// Write stores the token in the Secret, creating it if needed
+func (k *Kubernetes) Write(ctx context.Context, token string) error {
+	return k.client.WriteSecretKey(ctx, k.namespace, k.name, k.key, token)
+}
+
+// Read returns the token stored in the Secret
+func (k *Kubernetes) Read(ctx context.Context) (string, error) {
+	token, err := k.client.ReadSecretKey(ctx, k.namespace, k.name, k.key)
+	if errors.Is(err, kubernetes.ErrNotFound) {
+		return "", fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return token, err
+}
+
+// Delete removes the token key from the Secret
+func (k *Kubernetes) Delete(ctx context.Context) error {
+	return k.client.DeleteSecretKey(ctx, k.namespace, k.name, k.key)
+}
+
+// Describe returns the Secret namespace, name and key
+func (k *Kubernetes) Describe() string {
+	namespace := k.namespace
+	if namespace == "" {
+		namespace = "<default>"
+	}
+	return fmt.Sprintf("kubernetes:%s/%s[%s]", namespace, k.name, k.key)
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/wbh1/latr/internal/config"
+)
+
+// Storage is a destination that rotated tokens are delivered to
+type Storage interface {
+	// Write stores the token value, replacing any previous value
+	Write(ctx context.Context, token string) error
+	// Read returns the currently stored token value
+	// A destination that holds no token is reported as ErrNotFound.
+	Read(ctx context.Context) (string, error)
+	// Delete removes the stored token value
+	Delete(ctx context.Context) error
+	// Describe returns a human-readable description of the destination for logs and errors
+	Describe() string
+}
+
+// ErrNotFound is returned by Storage.Read when the destination holds no token
+// Any other read error means the destination's content is unknown.
+var ErrNotFound = errors.New("no token stored")
+
+// CASStorage is a Storage that supports check-and-set writes
+type CASStorage interface {
+	Storage
+	// WriteCAS stores the token along with its Linode ID, only if the destination is
+	// still at version. A concurrent modification is reported as vault.ErrVersionConflict.
+	WriteCAS(ctx context.Context, token string, linodeID, version int) error
+	// ReadLinodeID returns the Linode ID stored with the token by WriteCAS, or 0 if
+	// the token was written without one
+	ReadLinodeID(ctx context.Context) (int, error)
+}
+
+// Factory creates a Storage from its configuration
+type Factory func(cfg config.StorageConfig) (Storage, error)
+
+// Options creates the empty options struct a storage type's entries are decoded into
+type Options func() interface{}
+
+// registration is a registered storage type
+type registration struct {
+	factory    Factory
+	newOptions Options
+}
+
+// Registry maps storage types to the factories that create them and the options they take
+// It implements config.StorageTypes, so entries of types registered beyond the built-in
+// ones are validated against it by Config.ValidateStorage.
+type Registry struct {
+	types map[string]registration
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		types: make(map[string]registration),
+	}
+}
+
+// NewDefaultRegistry creates a registry with all built-in storage types registered
+// kubeClient may be nil if no token uses kubernetes storage
+func NewDefaultRegistry(vaultClient VaultClient, kubeClient KubernetesClient) *Registry {
+	r := NewRegistry()
+	r.Register(config.StorageTypeVault, NewVaultFactory(vaultClient), builtinOptions(config.StorageTypeVault))
+	r.Register(config.StorageTypeFile, NewFile, builtinOptions(config.StorageTypeFile))
+	r.Register(config.StorageTypeKubernetes, NewKubernetesFactory(kubeClient), builtinOptions(config.StorageTypeKubernetes))
+	return r
+}
+
+// builtinOptions returns the options constructor of a built-in storage type
+func builtinOptions(storageType string) Options {
+	return func() interface{} {
+		options, _ := config.BuiltinStorageTypes.NewOptions(storageType)
+		return options
+	}
+}
+
+// Register adds a factory for a storage type along with the options its entries take,
+// replacing any existing one
+// newOptions may be nil for types without options, whose entries then can't have any.
+func (r *Registry) Register(storageType string, factory Factory, newOptions Options) {
+	if newOptions == nil {
+		newOptions = func() interface{} { return &struct{}{} }
+	}
+	r.types[storageType] = registration{factory: factory, newOptions: newOptions}
+}
+
+// NewOptions returns an empty options struct for storageType, or false if it isn't registered
+func (r *Registry) NewOptions(storageType string) (interface{}, bool) {
+	registered, ok := r.types[storageType]
+	if !ok {
+		return nil, false
+	}
+	return registered.newOptions(), true
+}
+
+// New creates the Storage for a storage configuration
+func (r *Registry) New(cfg config.StorageConfig) (Storage, error) {
+	registered, ok := r.types[cfg.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage type %q (registered: %v)", cfg.Type, r.Types())
+	}
+
+	s, err := registered.factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s storage for %s: %w", cfg.Type, cfg.Path, err)
+	}
+
+	return s, nil
+}
+
+// Types returns the registered storage types in sorted order
+func (r *Registry) Types() []string {
+	types := make([]string, 0, len(r.types))
+	for t := range r.types {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
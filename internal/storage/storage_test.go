@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/kubernetes"
+	"github.com/wbh1/latr/internal/vault"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// MockVaultClient is a mock implementation of the Vault client
+type MockVaultClient struct {
+	mock.Mock
+}
+
+func (m *MockVaultClient) WriteToken(ctx context.Context, path, token string) error {
+	args := m.Called(ctx, path, token)
+	return args.Error(0)
+}
+
+func (m *MockVaultClient) ReadToken(ctx context.Context, path string) (string, error) {
+	args := m.Called(ctx, path)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockVaultClient) DeleteToken(ctx context.Context, path string) error {
+	args := m.Called(ctx, path)
+	return args.Error(0)
+}
+
+func TestRegistry_UnknownType(t *testing.T) {
+	registry := NewDefaultRegistry(new(MockVaultClient), nil)
+
+	s, err := registry.New(config.StorageConfig{Type: "vualt", Path: "linode/tokens/test"})
+	require.Error(t, err)
+	assert.Nil(t, s)
+	assert.Contains(t, err.Error(), `unknown storage type "vualt"`)
+}
+
+func TestRegistry_CustomType(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("memory", func(cfg config.StorageConfig) (Storage, error) {
+		return nil, errors.New("not implemented")
+	}, nil)
+
+	assert.Equal(t, []string{"memory"}, registry.Types())
+
+	// Registered types are accepted by the configuration, without options unless they take some
+	// Entries of built-in types are left to Config.Validate
+	cfg := &config.Config{Tokens: []config.TokenConfig{
+		{Label: "test", Storage: []config.StorageConfig{
+			{Type: "vault", Path: "linode/tokens/test"},
+			{Type: "memory", Path: "test"},
+		}},
+	}}
+	require.NoError(t, cfg.ValidateStorage(registry))
+	cfg.Tokens[0].Storage[1].Options = map[string]interface{}{"size": 1}
+	err := cfg.ValidateStorage(registry)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `token[0] "test": storage[1]: invalid memory storage options`)
+
+	_, err = registry.New(config.StorageConfig{Type: "memory", Path: "test"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create memory storage for test")
+}
+
+func TestVaultStorage(t *testing.T) {
+	mockVault := new(MockVaultClient)
+	mockVault.On("WriteToken", mock.Anything, "linode/tokens/test", "my-secret-token").Return(nil)
+	mockVault.On("ReadToken", mock.Anything, "linode/tokens/test").Return("my-secret-token", nil)
+	mockVault.On("DeleteToken", mock.Anything, "linode/tokens/test").Return(nil)
+
+	registry := NewDefaultRegistry(mockVault, nil)
+	s, err := registry.New(config.StorageConfig{Type: "vault", Path: "linode/tokens/test"})
+	require.NoError(t, err)
+	assert.Equal(t, "vault:linode/tokens/test", s.Describe())
+
+	ctx := context.Background()
+	require.NoError(t, s.Write(ctx, "my-secret-token"))
+
+	token, err := s.Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "my-secret-token", token)
+
+	require.NoError(t, s.Delete(ctx))
+	mockVault.AssertExpectations(t)
+}
+
+func TestVaultStorage_ReadNotFound(t *testing.T) {
+	mockVault := new(MockVaultClient)
+	mockVault.On("ReadToken", mock.Anything, "linode/tokens/missing").
+		Return("", fmt.Errorf("%w at path: linode/tokens/missing", vault.ErrNotFound))
+	mockVault.On("ReadToken", mock.Anything, "linode/tokens/denied").
+		Return("", errors.New("permission denied"))
+
+	registry := NewDefaultRegistry(mockVault, nil)
+	ctx := context.Background()
+
+	missing, err := registry.New(config.StorageConfig{Type: "vault", Path: "linode/tokens/missing"})
+	require.NoError(t, err)
+	_, err = missing.Read(ctx)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Only a missing secret is reported as not found
+	denied, err := registry.New(config.StorageConfig{Type: "vault", Path: "linode/tokens/denied"})
+	require.NoError(t, err)
+	_, err = denied.Read(ctx)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotFound)
+}
+
+func TestVaultStorage_Describe(t *testing.T) {
+	registry := NewDefaultRegistry(new(MockVaultClient), nil)
+
+	s, err := registry.New(config.StorageConfig{
+		Type:    "vault",
+		Path:    "linode/tokens/test",
+		Options: map[string]interface{}{"namespace": "team-a", "mount": "kv"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "vault:team-a/kv/linode/tokens/test", s.Describe())
+}
+
+func TestFileStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+
+	registry := NewDefaultRegistry(nil, nil)
+	s, err := registry.New(config.StorageConfig{
+		Type:    "file",
+		Path:    path,
+		Options: map[string]interface{}{"format": "json", "mode": "0640"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "file:"+path, s.Describe())
+
+	ctx := context.Background()
+	require.NoError(t, s.Write(ctx, "my-secret-token"))
+
+	token, err := s.Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "my-secret-token", token)
+
+	require.NoError(t, s.Delete(ctx))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = s.Read(ctx)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting a missing file is not an error
+	require.NoError(t, s.Delete(ctx))
+}
+
+func TestFileStorage_InvalidOptions(t *testing.T) {
+	registry := NewDefaultRegistry(nil, nil)
+
+	_, err := registry.New(config.StorageConfig{
+		Type:    "file",
+		Path:    "/tmp/token",
+		Options: map[string]interface{}{"mode": "not-octal"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid file mode")
+}
+
+func TestKubernetesStorage(t *testing.T) {
+	kubeClient := kubernetes.NewClientFromClientset(fake.NewSimpleClientset(), "latr")
+
+	registry := NewDefaultRegistry(nil, kubeClient)
+	s, err := registry.New(config.StorageConfig{
+		Type:    "kubernetes",
+		Path:    "linode-token",
+		Options: map[string]interface{}{"namespace": "apps"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "kubernetes:apps/linode-token[token]", s.Describe())
+
+	ctx := context.Background()
+	require.NoError(t, s.Write(ctx, "my-secret-token"))
+
+	token, err := s.Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "my-secret-token", token)
+
+	require.NoError(t, s.Delete(ctx))
+	_, err = s.Read(ctx)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestKubernetesStorage_NoClient(t *testing.T) {
+	registry := NewDefaultRegistry(nil, nil)
+
+	_, err := registry.New(config.StorageConfig{Type: "kubernetes", Path: "linode-token"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no kubernetes client is available")
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wbh1/latr/internal/config"
+	"github.com/wbh1/latr/internal/vault"
+)
+
+// VaultClient defines the Vault operations used by vault storage
+type VaultClient interface {
+	WriteToken(ctx context.Context, path, token string) error
+	ReadToken(ctx context.Context, path string) (string, error)
+	DeleteToken(ctx context.Context, path string) error
+}
+
+// casVaultClient is implemented by Vault clients that support check-and-set writes
+type casVaultClient interface {
+	WriteTokenCAS(ctx context.Context, path, token string, linodeID, version int) error
+	ReadTokenLinodeID(ctx context.Context, path string) (int, error)
+}
+
+// Vault stores tokens in a Vault KV path
+type Vault struct {
+	client    VaultClient
+	path      string
+	namespace string
+	mount     string
+}
+
+// NewVaultFactory returns a Factory that creates vault storage using client
+func NewVaultFactory(client VaultClient) Factory {
+	return func(cfg config.StorageConfig) (Storage, error) {
+		if client == nil {
+			return nil, fmt.Errorf("no vault client is available")
+		}
+
+		var opts config.VaultStorageOptions
+		if err := cfg.DecodeOptions(&opts); err != nil {
+			return nil, err
+		}
+
+		return &Vault{
+			client:    client,
+			path:      cfg.Path,
+			namespace: opts.Namespace,
+			mount:     opts.Mount,
+		}, nil
+	}
+}
+
+// Write stores the token in Vault
+func (v *Vault) Write(ctx context.Context, token string) error {
+	return v.client.WriteToken(v.context(ctx), v.path, token)
+}
+
+// WriteCAS stores the token and its Linode ID in Vault if the secret is still at version
+// Clients without check-and-set support write the token unconditionally
+func (v *Vault) WriteCAS(ctx context.Context, token string, linodeID, version int) error {
+	client, ok := v.client.(casVaultClient)
+	if !ok {
+		return v.Write(ctx, token)
+	}
+	return client.WriteTokenCAS(v.context(ctx), v.path, token, linodeID, version)
+}
+
+// ReadLinodeID returns the Linode ID stored with the token in Vault
+func (v *Vault) ReadLinodeID(ctx context.Context) (int, error) {
+	client, ok := v.client.(casVaultClient)
+	if !ok {
+		return 0, nil
+	}
+	return client.ReadTokenLinodeID(v.context(ctx), v.path)
+}
+
+// Read returns the token stored in Vault
+func (v *Vault) Read(ctx context.Context) (string, error) {
+	token, err := v.client.ReadToken(v.context(ctx), v.path)
+	if errors.Is(err, vault.ErrNotFound) {
+		return "", fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return token, err
+}
+
+// Delete removes the token from Vault
+func (v *Vault) Delete(ctx context.Context) error {
+	return v.client.DeleteToken(v.context(ctx), v.path)
+}
+
+// Describe returns the Vault path, prefixed with the namespace and mount overrides if any
+func (v *Vault) Describe() string {
+	path := v.path
+	if v.mount != "" {
+		path = strings.Trim(v.mount, "/") + "/" + path
+	}
+	if v.namespace != "" {
+		path = strings.Trim(v.namespace, "/") + "/" + path
+	}
+	return "vault:" + path
+}
+
+// context scopes Vault requests to the configured namespace and mount
+func (v *Vault) context(ctx context.Context) context.Context {
+	return vault.WithMount(vault.WithNamespace(ctx, v.namespace), v.mount)
+}
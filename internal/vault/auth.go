@@ -0,0 +1,240 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/wbh1/latr/internal/observability"
+)
+
+// reauthRetryInterval is how long the renewal loop waits after a failed login
+var reauthRetryInterval = 30 * time.Second
+
+// login authenticates with the configured auth method and switches the client to the new token
+func (c *Client) login() error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	return c.loginLocked()
+}
+
+func (c *Client) loginLocked() error {
+	secret, err := authenticate(c.client, c.config)
+	if err != nil {
+		return err
+	}
+
+	c.client.SetToken(secret.Auth.ClientToken)
+	c.authSecret = secret
+
+	return nil
+}
+
+// reauthenticate logs in again unless another caller already replaced staleToken
+func (c *Client) reauthenticate(staleToken string) error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	if c.client.Token() != staleToken {
+		return nil
+	}
+
+	if err := c.loginLocked(); err != nil {
+		return err
+	}
+
+	// Let the renewal loop pick up the new lease
+	select {
+	case c.authChanged <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// withReauth runs op, and if Vault rejects the token with a 403 it logs in again and retries once
+func (c *Client) withReauth(ctx context.Context, op func() error) error {
+	token := c.client.Token()
+
+	err := op()
+	if !isPermissionDenied(err) {
+		return err
+	}
+
+	attrs := append([]any{slog.Any("error", err)}, observability.TraceAttrs(ctx)...)
+	observability.GetLogger().WarnContext(ctx, "Vault denied request, re-authenticating", attrs...)
+
+	if authErr := c.reauthenticate(token); authErr != nil {
+		return fmt.Errorf("%w (re-authentication failed: %v)", err, authErr)
+	}
+
+	return op()
+}
+
+// isPermissionDenied reports whether err is a 403 response from Vault
+func isPermissionDenied(err error) bool {
+	var respErr *api.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden
+}
+
+// StartRenewal keeps the Vault token alive in the background until ctx is cancelled
+// The lease is renewed for as long as Vault allows, after which the client logs in again
+func (c *Client) StartRenewal(ctx context.Context) {
+	go c.renewLoop(ctx)
+}
+
+func (c *Client) renewLoop(ctx context.Context) {
+	logger := observability.GetLogger()
+
+	for {
+		c.authMu.Lock()
+		secret := c.authSecret
+		c.authMu.Unlock()
+
+		if !c.watchLease(ctx, secret) {
+			return
+		}
+
+		// Renewal is no longer possible, so get a fresh token
+		for {
+			err := c.login()
+			if err == nil {
+				logger.InfoContext(ctx, "Re-authenticated with Vault")
+				break
+			}
+
+			logger.ErrorContext(ctx, "Failed to re-authenticate with Vault",
+				slog.Any("error", err),
+				slog.Duration("retry_in", reauthRetryInterval))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reauthRetryInterval):
+			}
+		}
+	}
+}
+
+// watchLease renews secret until renewal stops being possible
+// It returns false when ctx is cancelled. A login made elsewhere restarts the
+// watch with the new lease without logging in again.
+func (c *Client) watchLease(ctx context.Context, secret *api.Secret) bool {
+	logger := observability.GetLogger()
+
+	for {
+		// Tokens without a TTL never need renewing
+		if secret == nil || secret.Auth == nil || secret.Auth.LeaseDuration == 0 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-c.authChanged:
+				c.authMu.Lock()
+				secret = c.authSecret
+				c.authMu.Unlock()
+				continue
+			}
+		}
+
+		watcher, err := c.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to create Vault token watcher", slog.Any("error", err))
+			return true
+		}
+
+		go watcher.Start()
+
+		restart := false
+		for !restart {
+			select {
+			case <-ctx.Done():
+				watcher.Stop()
+				return false
+			case <-c.authChanged:
+				c.authMu.Lock()
+				secret = c.authSecret
+				c.authMu.Unlock()
+				restart = true
+			case renewal := <-watcher.RenewCh():
+				logger.DebugContext(ctx, "Renewed Vault token",
+					slog.Int("lease_duration_seconds", renewal.Secret.Auth.LeaseDuration))
+			case err := <-watcher.DoneCh():
+				if err != nil {
+					logger.WarnContext(ctx, "Vault token renewal failed", slog.Any("error", err))
+				}
+				watcher.Stop()
+				return true
+			}
+		}
+		watcher.Stop()
+	}
+}
+
+// authenticate logs in using the configured auth method
+func authenticate(client *api.Client, config *Config) (*api.Secret, error) {
+	method := config.AuthMethod
+	if method == "" {
+		method = AuthMethodAppRole
+	}
+
+	mountPath := config.AuthMountPath
+	if mountPath == "" {
+		mountPath = method
+	}
+
+	switch method {
+	case AuthMethodAppRole:
+		return authenticateAppRole(client, mountPath, config.RoleID, config.SecretID)
+	case AuthMethodKubernetes:
+		return authenticateKubernetes(client, mountPath, config.KubernetesRole, config.JWTPath)
+	default:
+		return nil, fmt.Errorf("unsupported auth method: %s", method)
+	}
+}
+
+// authenticateAppRole performs AppRole authentication
+func authenticateAppRole(client *api.Client, mountPath, roleID, secretID string) (*api.Secret, error) {
+	data := map[string]interface{}{
+		"role_id":   roleID,
+		"secret_id": secretID,
+	}
+
+	return loginWith(client, mountPath, data)
+}
+
+// authenticateKubernetes performs Kubernetes authentication using the pod's service account token
+// The token file is re-read on every login since projected tokens are rotated by the kubelet
+func authenticateKubernetes(client *api.Client, mountPath, role, jwtPath string) (*api.Secret, error) {
+	jwt, err := os.ReadFile(jwtPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	data := map[string]interface{}{
+		"role": role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	}
+
+	return loginWith(client, mountPath, data)
+}
+
+// loginWith writes credentials to an auth mount's login endpoint
+func loginWith(client *api.Client, mountPath string, data map[string]interface{}) (*api.Secret, error) {
+	resp, err := client.Logical().Write(fmt.Sprintf("auth/%s/login", mountPath), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	if resp == nil || resp.Auth == nil {
+		return nil, fmt.Errorf("no auth info returned from vault")
+	}
+
+	return resp, nil
+}
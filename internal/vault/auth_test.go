@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLoginServer returns a Vault server that issues a new token on every AppRole login
+// and only accepts requests made with the most recently issued token
+func newLoginServer(t *testing.T, leaseDuration int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/approle/login" {
+			n := atomic.AddInt32(&logins, 1)
+			response := map[string]interface{}{
+				"auth": map[string]interface{}{
+					"client_token":   fmt.Sprintf("token-%d", n),
+					"lease_duration": leaseDuration,
+					"renewable":      false,
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		if r.Header.Get("X-Vault-Token") != fmt.Sprintf("token-%d", atomic.LoadInt32(&logins)) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+
+		if r.URL.Path == "/v1/secret/data/test/path" && r.Method == http.MethodGet {
+			response := map[string]interface{}{
+				"data": map[string]interface{}{
+					"data": map[string]interface{}{
+						"token": "my-token",
+					},
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &logins
+}
+
+func TestWithReauth_RetriesOnPermissionDenied(t *testing.T) {
+	server, logins := newLoginServer(t, 3600)
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		KVVersion: 2,
+	})
+	require.NoError(t, err)
+
+	// Simulate the token expiring
+	client.client.SetToken("expired-token")
+
+	token, err := client.ReadToken(context.Background(), "test/path")
+	require.NoError(t, err)
+	assert.Equal(t, "my-token", token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(logins))
+}
+
+func TestWithReauth_RetriesOnlyOnce(t *testing.T) {
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/approle/login" {
+			atomic.AddInt32(&logins, 1)
+			response := map[string]interface{}{
+				"auth": map[string]interface{}{
+					"client_token": "test-token",
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"errors":["permission denied"]}`)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		KVVersion: 2,
+	})
+	require.NoError(t, err)
+
+	err = client.WriteToken(context.Background(), "test/path", "my-token")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to write token to vault")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&logins))
+}
+
+func TestStartRenewal_ReauthenticatesWhenLeaseEnds(t *testing.T) {
+	server, logins := newLoginServer(t, 1)
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		KVVersion: 2,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.StartRenewal(ctx)
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(logins) >= 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// The client keeps working with the new token
+	err = client.WriteToken(ctx, "test/path", "my-token")
+	require.NoError(t, err)
+}
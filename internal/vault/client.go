@@ -2,80 +2,150 @@ package vault
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/wbh1/latr/pkg/models"
 )
 
+// Supported auth methods
+const (
+	AuthMethodAppRole    = "approle"
+	AuthMethodKubernetes = "kubernetes"
+)
+
 // Config holds Vault client configuration
 type Config struct {
 	Address   string
 	RoleID    string
 	SecretID  string
 	MountPath string
+	Namespace string // Vault Enterprise namespace, empty for the root namespace
+	KVVersion int    // KV engine version of the mount (1 or 2), 0 detects it
+
+	AuthMethod     string // approle (default) or kubernetes
+	AuthMountPath  string // Auth mount path, defaults to the method name
+	KubernetesRole string // Vault role for kubernetes auth
+	JWTPath        string // Service account token path for kubernetes auth
+
+	CACert             string // PEM CA bundle used to verify the server
+	CAPath             string // Directory of PEM CA certificates
+	ClientCert         string // PEM client certificate for mTLS
+	ClientKey          string // PEM client key for mTLS
+	TLSServerName      string // SNI host name, when it differs from the address
+	InsecureSkipVerify bool   // Disable server certificate verification (testing only)
 }
 
 // Client wraps the Vault API client
 type Client struct {
 	client    *api.Client
 	mountPath string
+	config    *Config
+
+	authMu      sync.Mutex
+	authSecret  *api.Secret   // Result of the most recent login, watched for renewal
+	authChanged chan struct{} // Signals the renewal loop that a new login happened
+
+	kvMu       sync.Mutex
+	kvVersions map[kvMount]int // Detected KV version per mount
 }
 
-// NewClient creates a new Vault client and authenticates using AppRole
+// NewClient creates a new Vault client and authenticates using the configured auth method
 func NewClient(config *Config) (*Client, error) {
 	vaultConfig := api.DefaultConfig()
 	vaultConfig.Address = config.Address
 
+	// Settings left empty keep the values from the VAULT_* environment variables
+	tlsConfig := &api.TLSConfig{
+		CACert:        config.CACert,
+		CAPath:        config.CAPath,
+		ClientCert:    config.ClientCert,
+		ClientKey:     config.ClientKey,
+		TLSServerName: config.TLSServerName,
+		Insecure:      config.InsecureSkipVerify,
+	}
+	if err := vaultConfig.ConfigureTLS(tlsConfig); err != nil {
+		return nil, fmt.Errorf("failed to configure vault tls: %w", err)
+	}
+
 	client, err := api.NewClient(vaultConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create vault client: %w", err)
 	}
 
-	// Authenticate using AppRole
-	if err := authenticateAppRole(client, config.RoleID, config.SecretID); err != nil {
+	// Applies to the login as well, since the auth mount lives in the namespace
+	if config.Namespace != "" {
+		client.SetNamespace(config.Namespace)
+	}
+
+	c := &Client{
+		client:      client,
+		mountPath:   config.MountPath,
+		config:      config,
+		authChanged: make(chan struct{}, 1),
+		kvVersions:  make(map[kvMount]int),
+	}
+
+	if err := c.login(); err != nil {
 		return nil, fmt.Errorf("failed to authenticate with vault: %w", err)
 	}
 
-	return &Client{
-		client:    client,
-		mountPath: config.MountPath,
-	}, nil
+	return c, nil
 }
 
-// authenticateAppRole performs AppRole authentication
-func authenticateAppRole(client *api.Client, roleID, secretID string) error {
-	data := map[string]interface{}{
-		"role_id":   roleID,
-		"secret_id": secretID,
-	}
+// ErrVersionConflict is returned by WriteTokenCAS when the secret changed since its version was read
+var ErrVersionConflict = errors.New("secret was modified concurrently (check-and-set version mismatch)")
 
-	resp, err := client.Logical().Write("auth/approle/login", data)
-	if err != nil {
-		return fmt.Errorf("failed to authenticate: %w", err)
-	}
+// ErrNotFound is returned by ReadToken when there is no secret at the path
+// On KV v2 this includes a secret whose latest version was deleted.
+var ErrNotFound = errors.New("secret not found")
 
-	if resp == nil || resp.Auth == nil {
-		return fmt.Errorf("no auth info returned from vault")
-	}
+// WriteToken writes a token value to a KV path
+func (c *Client) WriteToken(ctx context.Context, path string, token string) error {
+	return c.writeToken(ctx, path, token, 0, nil)
+}
 
-	client.SetToken(resp.Auth.ClientToken)
-	return nil
+// WriteTokenCAS writes a token value only if the secret is still at version
+// Version 0 means the secret must not exist yet. KV v1 has no versions, so the
+// write is unconditional there. The token's Linode ID is written along with it,
+// so that a writer that lost the race can tell whose token is stored.
+func (c *Client) WriteTokenCAS(ctx context.Context, path string, token string, linodeID, version int) error {
+	return c.writeToken(ctx, path, token, linodeID, &version)
 }
 
-// WriteToken writes a token value to a KV v2 path
-func (c *Client) WriteToken(ctx context.Context, path string, token string) error {
-	fullPath := fmt.Sprintf("%s/data/%s", c.mountPath, path)
+func (c *Client) writeToken(ctx context.Context, path string, token string, linodeID int, cas *int) error {
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to write token to vault: %w", err)
+	}
 
-	data := map[string]interface{}{
-		"data": map[string]interface{}{
-			"token": token,
-		},
+	fields := map[string]interface{}{
+		"token": token,
+	}
+	if linodeID != 0 {
+		fields["linode_id"] = strconv.Itoa(linodeID)
+	}
+	data := wrapData(version, fields)
+	if cas != nil && version != 1 {
+		data["options"] = map[string]interface{}{
+			"cas": *cas,
+		}
 	}
 
-	_, err := c.client.Logical().WriteWithContext(ctx, fullPath, data)
+	err = c.withReauth(ctx, func() error {
+		_, err := c.logical(ctx).WriteWithContext(ctx, c.dataPath(ctx, version, path), data)
+		return err
+	})
+	if isCASMismatch(err) {
+		return fmt.Errorf("failed to write token to vault: %w", ErrVersionConflict)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to write token to vault: %w", err)
 	}
@@ -83,20 +153,30 @@ func (c *Client) WriteToken(ctx context.Context, path string, token string) erro
 	return nil
 }
 
-// ReadToken reads a token value from a KV v2 path
+// ReadToken reads a token value from a KV path
 func (c *Client) ReadToken(ctx context.Context, path string) (string, error) {
-	fullPath := fmt.Sprintf("%s/data/%s", c.mountPath, path)
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token from vault: %w", err)
+	}
 
-	secret, err := c.client.Logical().ReadWithContext(ctx, fullPath)
+	var secret *api.Secret
+	err = c.withReauth(ctx, func() (err error) {
+		secret, err = c.logical(ctx).ReadWithContext(ctx, c.dataPath(ctx, version, path))
+		return err
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to read token from vault: %w", err)
 	}
 
 	if secret == nil || secret.Data == nil {
-		return "", fmt.Errorf("no data found at path: %s", path)
+		return "", fmt.Errorf("%w at path: %s", ErrNotFound, path)
 	}
 
-	data, ok := secret.Data["data"].(map[string]interface{})
+	data, ok := unwrapData(version, secret)
+	if ok && data == nil {
+		return "", fmt.Errorf("%w at path: %s", ErrNotFound, path)
+	}
 	if !ok {
 		return "", fmt.Errorf("invalid data structure at path: %s", path)
 	}
@@ -109,27 +189,82 @@ func (c *Client) ReadToken(ctx context.Context, path string) (string, error) {
 	return tokenValue, nil
 }
 
-// WriteTokenState writes token state to Vault metadata
-func (c *Client) WriteTokenState(ctx context.Context, path string, state *models.TokenState) error {
-	metadataPath := fmt.Sprintf("%s/metadata/%s", c.mountPath, path)
+// ReadTokenLinodeID returns the Linode ID written with the token by WriteTokenCAS
+// 0 is returned for a token written without one, e.g. by hand.
+func (c *Client) ReadTokenLinodeID(ctx context.Context, path string) (int, error) {
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read token from vault: %w", err)
+	}
 
-	customMetadata := map[string]interface{}{
-		"label":              state.Label,
-		"current_linode_id":  strconv.Itoa(state.CurrentLinodeID),
-		"last_rotated_at":    state.LastRotatedAt.Format(time.RFC3339),
-		"previous_linode_id": strconv.Itoa(state.PreviousLinodeID),
-		"rotation_count":     strconv.Itoa(state.RotationCount),
+	var secret *api.Secret
+	err = c.withReauth(ctx, func() (err error) {
+		secret, err = c.logical(ctx).ReadWithContext(ctx, c.dataPath(ctx, version, path))
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read token from vault: %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return 0, fmt.Errorf("%w at path: %s", ErrNotFound, path)
 	}
 
-	if !state.PreviousExpiresAt.IsZero() {
-		customMetadata["previous_expires_at"] = state.PreviousExpiresAt.Format(time.RFC3339)
+	data, _ := unwrapData(version, secret)
+	id, ok := data["linode_id"].(string)
+	if !ok {
+		return 0, nil
 	}
+	linodeID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, fmt.Errorf("invalid linode_id %q at path: %s", id, path)
+	}
+	return linodeID, nil
+}
 
-	data := map[string]interface{}{
-		"custom_metadata": customMetadata,
+// DeleteToken deletes a token from a KV path
+// On KV v2 only the latest version is deleted, and metadata (including token state)
+// is kept so rotation history is preserved. On KV v1 the state key is kept as well.
+func (c *Client) DeleteToken(ctx context.Context, path string) error {
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete token from vault: %w", err)
+	}
+
+	err = c.withReauth(ctx, func() error {
+		_, err := c.logical(ctx).DeleteWithContext(ctx, c.dataPath(ctx, version, path))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete token from vault: %w", err)
 	}
 
-	_, err := c.client.Logical().WriteWithContext(ctx, metadataPath, data)
+	return nil
+}
+
+// WriteTokenState writes token state to Vault
+// KV v2 keeps it in the secret's custom metadata, KV v1 in a sibling key
+func (c *Client) WriteTokenState(ctx context.Context, path string, state *models.TokenState) error {
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to write token state to vault: %w", err)
+	}
+
+	statePath := c.statePath(ctx, version, path)
+	fields := encodeState(state)
+
+	var data map[string]interface{}
+	if version == 1 {
+		data = fields
+	} else {
+		data = map[string]interface{}{
+			"custom_metadata": fields,
+		}
+	}
+
+	err = c.withReauth(ctx, func() error {
+		_, err := c.logical(ctx).WriteWithContext(ctx, statePath, data)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to write token state to vault: %w", err)
 	}
@@ -137,60 +272,173 @@ func (c *Client) WriteTokenState(ctx context.Context, path string, state *models
 	return nil
 }
 
-// ReadTokenState reads token state from Vault metadata
+// ReadTokenState reads token state from Vault
 func (c *Client) ReadTokenState(ctx context.Context, path string) (*models.TokenState, error) {
-	metadataPath := fmt.Sprintf("%s/metadata/%s", c.mountPath, path)
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token state from vault: %w", err)
+	}
+
+	statePath := c.statePath(ctx, version, path)
 
-	secret, err := c.client.Logical().ReadWithContext(ctx, metadataPath)
+	var secret *api.Secret
+	err = c.withReauth(ctx, func() (err error) {
+		secret, err = c.logical(ctx).ReadWithContext(ctx, statePath)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to read token state from vault: %w", err)
 	}
 
-	// If no metadata exists yet, return nil (this is a new token)
+	// If no state exists yet, return nil (this is a new token)
 	if secret == nil || secret.Data == nil {
 		return nil, nil
 	}
 
+	if version == 1 {
+		return decodeState(secret.Data), nil
+	}
+
+	// The version is needed for check-and-set even if latr hasn't stored state yet
+	currentVersion := 0
+	if v, ok := secret.Data["current_version"].(json.Number); ok {
+		if n, err := v.Int64(); err == nil {
+			currentVersion = int(n)
+		}
+	}
+
 	customMetadata, ok := secret.Data["custom_metadata"].(map[string]interface{})
 	if !ok {
-		return nil, nil
+		if currentVersion == 0 {
+			return nil, nil
+		}
+		return &models.TokenState{Version: currentVersion}, nil
+	}
+
+	state := decodeState(customMetadata)
+	state.Version = currentVersion
+	return state, nil
+}
+
+// isCASMismatch reports whether err is Vault rejecting a write because of a stale cas version
+func isCASMismatch(err error) bool {
+	var respErr *api.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, e := range respErr.Errors {
+		if strings.Contains(e, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
+
+// backendStatePrefix prefixes the state fields holding the token ID each storage backend has
+const backendStatePrefix = "backend:"
+
+// encodeState converts token state to string fields, as required by KV v2 custom metadata
+func encodeState(state *models.TokenState) map[string]interface{} {
+	fields := map[string]interface{}{
+		"label":              state.Label,
+		"current_linode_id":  strconv.Itoa(state.CurrentLinodeID),
+		"last_rotated_at":    state.LastRotatedAt.Format(time.RFC3339),
+		"previous_linode_id": strconv.Itoa(state.PreviousLinodeID),
+		"rotation_count":     strconv.Itoa(state.RotationCount),
+	}
+
+	if state.DeliveredLinodeID != 0 {
+		fields["delivered_linode_id"] = strconv.Itoa(state.DeliveredLinodeID)
+	}
+
+	if !state.PreviousExpiresAt.IsZero() {
+		fields["previous_expires_at"] = state.PreviousExpiresAt.Format(time.RFC3339)
+	}
+
+	for backend, id := range state.Backends {
+		fields[backendStatePrefix+backend] = strconv.Itoa(id)
 	}
 
+	return fields
+}
+
+// decodeState parses token state written by encodeState
+func decodeState(fields map[string]interface{}) *models.TokenState {
 	state := &models.TokenState{}
 
-	if label, ok := customMetadata["label"].(string); ok {
+	if label, ok := fields["label"].(string); ok {
 		state.Label = label
 	}
 
-	if currentID, ok := customMetadata["current_linode_id"].(string); ok {
+	if currentID, ok := fields["current_linode_id"].(string); ok {
 		if id, err := strconv.Atoi(currentID); err == nil {
 			state.CurrentLinodeID = id
 		}
 	}
 
-	if lastRotated, ok := customMetadata["last_rotated_at"].(string); ok {
+	if deliveredID, ok := fields["delivered_linode_id"].(string); ok {
+		if id, err := strconv.Atoi(deliveredID); err == nil {
+			state.DeliveredLinodeID = id
+		}
+	}
+
+	if lastRotated, ok := fields["last_rotated_at"].(string); ok {
 		if t, err := time.Parse(time.RFC3339, lastRotated); err == nil {
 			state.LastRotatedAt = t
 		}
 	}
 
-	if previousID, ok := customMetadata["previous_linode_id"].(string); ok {
+	if previousID, ok := fields["previous_linode_id"].(string); ok {
 		if id, err := strconv.Atoi(previousID); err == nil {
 			state.PreviousLinodeID = id
 		}
 	}
 
-	if previousExpires, ok := customMetadata["previous_expires_at"].(string); ok {
+	if previousExpires, ok := fields["previous_expires_at"].(string); ok {
 		if t, err := time.Parse(time.RFC3339, previousExpires); err == nil {
 			state.PreviousExpiresAt = t
 		}
 	}
 
-	if rotationCount, ok := customMetadata["rotation_count"].(string); ok {
+	if rotationCount, ok := fields["rotation_count"].(string); ok {
 		if count, err := strconv.Atoi(rotationCount); err == nil {
 			state.RotationCount = count
 		}
 	}
 
-	return state, nil
+	for key, value := range fields {
+		backend, ok := strings.CutPrefix(key, backendStatePrefix)
+		if !ok {
+			continue
+		}
+		if s, ok := value.(string); ok {
+			if id, err := strconv.Atoi(s); err == nil {
+				if state.Backends == nil {
+					state.Backends = make(map[string]int)
+				}
+				state.Backends[backend] = id
+			}
+		}
+	}
+
+	return state
+}
+
+// WithNamespace returns a context whose Vault requests are made in namespace
+// instead of the client's namespace. An empty namespace leaves ctx unchanged.
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	if namespace == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+type namespaceKey struct{}
+
+// logical returns the logical API using the namespace from ctx, if any
+func (c *Client) logical(ctx context.Context) *api.Logical {
+	if namespace, ok := ctx.Value(namespaceKey{}).(string); ok {
+		return c.client.WithNamespace(namespace).Logical()
+	}
+	return c.client.Logical()
 }
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -67,6 +69,95 @@ func TestNewClient_AuthFailure(t *testing.T) {
 	assert.Contains(t, err.Error(), "failed to authenticate")
 }
 
+func TestNewClient_KubernetesAuth(t *testing.T) {
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(jwtPath, []byte("service-account-jwt\n"), 0600))
+
+	var loginData map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/k8s-prod/login" {
+			json.NewDecoder(r.Body).Decode(&loginData)
+			w.WriteHeader(http.StatusOK)
+			response := map[string]interface{}{
+				"auth": map[string]interface{}{
+					"client_token":   "test-token",
+					"lease_duration": 3600,
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Address:        server.URL,
+		MountPath:      "secret",
+		AuthMethod:     AuthMethodKubernetes,
+		AuthMountPath:  "k8s-prod",
+		KubernetesRole: "latr",
+		JWTPath:        jwtPath,
+	}
+
+	client, err := NewClient(config)
+	require.NoError(t, err)
+	require.NotNil(t, client)
+	assert.Equal(t, "latr", loginData["role"])
+	assert.Equal(t, "service-account-jwt", loginData["jwt"])
+}
+
+func TestNewClient_KubernetesAuthMissingJWT(t *testing.T) {
+	config := &Config{
+		Address:        "http://127.0.0.1:0",
+		MountPath:      "secret",
+		AuthMethod:     AuthMethodKubernetes,
+		KubernetesRole: "latr",
+		JWTPath:        filepath.Join(t.TempDir(), "missing"),
+	}
+
+	client, err := NewClient(config)
+	require.Error(t, err)
+	assert.Nil(t, client)
+	assert.Contains(t, err.Error(), "failed to read service account token")
+}
+
+func TestNamespace(t *testing.T) {
+	namespaces := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespaces[r.URL.Path] = r.Header.Get("X-Vault-Namespace")
+		if r.URL.Path == "/v1/auth/approle/login" {
+			response := map[string]interface{}{
+				"auth": map[string]interface{}{
+					"client_token": "test-token",
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		Namespace: "platform",
+		KVVersion: 2,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, client.WriteToken(ctx, "default", "my-token"))
+	require.NoError(t, client.WriteToken(WithNamespace(ctx, "platform/team-a"), "override", "my-token"))
+
+	assert.Equal(t, "platform", namespaces["/v1/auth/approle/login"])
+	assert.Equal(t, "platform", namespaces["/v1/secret/data/default"])
+	assert.Equal(t, "platform/team-a", namespaces["/v1/secret/data/override"])
+}
+
 func TestWriteToken(t *testing.T) {
 	writeCount := 0
 	var lastWrittenData map[string]interface{}
@@ -107,6 +198,7 @@ func TestWriteToken(t *testing.T) {
 		RoleID:    "test-role-id",
 		SecretID:  "test-secret-id",
 		MountPath: "secret",
+		KVVersion: 2,
 	}
 
 	client, err := NewClient(config)
@@ -164,6 +256,7 @@ func TestReadToken(t *testing.T) {
 		RoleID:    "test-role-id",
 		SecretID:  "test-secret-id",
 		MountPath: "secret",
+		KVVersion: 2,
 	}
 
 	client, err := NewClient(config)
@@ -198,6 +291,7 @@ func TestReadToken_NotFound(t *testing.T) {
 		RoleID:    "test-role-id",
 		SecretID:  "test-secret-id",
 		MountPath: "secret",
+		KVVersion: 2,
 	}
 
 	client, err := NewClient(config)
@@ -206,9 +300,52 @@ func TestReadToken_NotFound(t *testing.T) {
 	ctx := context.Background()
 	token, err := client.ReadToken(ctx, "nonexistent/path")
 	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 	assert.Empty(t, token)
 }
 
+func TestDeleteToken(t *testing.T) {
+	deleteCalled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/approle/login" {
+			w.WriteHeader(http.StatusOK)
+			response := map[string]interface{}{
+				"auth": map[string]interface{}{
+					"client_token":   "test-token",
+					"lease_duration": 3600,
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		if r.URL.Path == "/v1/secret/data/test/path" && r.Method == "DELETE" {
+			deleteCalled = true
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		KVVersion: 2,
+	}
+
+	client, err := NewClient(config)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = client.DeleteToken(ctx, "test/path")
+	require.NoError(t, err)
+	assert.True(t, deleteCalled)
+}
+
 func TestWriteTokenState(t *testing.T) {
 	var lastWrittenMetadata map[string]interface{}
 
@@ -242,6 +379,7 @@ func TestWriteTokenState(t *testing.T) {
 		RoleID:    "test-role-id",
 		SecretID:  "test-secret-id",
 		MountPath: "secret",
+		KVVersion: 2,
 	}
 
 	client, err := NewClient(config)
@@ -311,6 +449,7 @@ func TestReadTokenState(t *testing.T) {
 		RoleID:    "test-role-id",
 		SecretID:  "test-secret-id",
 		MountPath: "secret",
+		KVVersion: 2,
 	}
 
 	client, err := NewClient(config)
@@ -350,6 +489,7 @@ func TestReadTokenState_NotFound(t *testing.T) {
 		RoleID:    "test-role-id",
 		SecretID:  "test-secret-id",
 		MountPath: "secret",
+		KVVersion: 2,
 	}
 
 	client, err := NewClient(config)
@@ -0,0 +1,161 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/wbh1/latr/internal/observability"
+)
+
+// stateSuffix is appended to a token's path to form the sibling key holding its
+// state on KV v1 mounts, which have no custom metadata
+const stateSuffix = ".latr-state"
+
+// kvMount identifies a KV mount, which may differ per namespace
+type kvMount struct {
+	namespace string
+	mount     string
+}
+
+// WithMount returns a context whose Vault requests use mount instead of the
+// client's mount path. An empty mount leaves ctx unchanged.
+func WithMount(ctx context.Context, mount string) context.Context {
+	mount = strings.Trim(mount, "/")
+	if mount == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, mountKey{}, mount)
+}
+
+type mountKey struct{}
+
+// mount returns the KV mount for ctx
+func (c *Client) mount(ctx context.Context) string {
+	if mount, ok := ctx.Value(mountKey{}).(string); ok {
+		return mount
+	}
+	return c.mountPath
+}
+
+// KVVersion returns the KV version of the mount used by ctx, see WithMount
+func (c *Client) KVVersion(ctx context.Context) (int, error) {
+	return c.kvVersion(ctx)
+}
+
+// kvVersion returns the KV version of the mount used by ctx
+// An explicit KVVersion in the config wins, otherwise each mount is inspected
+// once through sys/internal/ui/mounts. Only a token that isn't allowed to inspect
+// the mount falls back to KV v2. Other failures are returned without caching
+// anything, so the next request detects the version again.
+func (c *Client) kvVersion(ctx context.Context) (int, error) {
+	if c.config.KVVersion != 0 {
+		return c.config.KVVersion, nil
+	}
+
+	key := kvMount{mount: c.mount(ctx)}
+	key.namespace, _ = ctx.Value(namespaceKey{}).(string)
+
+	c.kvMu.Lock()
+	defer c.kvMu.Unlock()
+
+	if version, ok := c.kvVersions[key]; ok {
+		return version, nil
+	}
+
+	version, err := c.detectKVVersion(ctx, key.mount)
+	switch {
+	case isPermissionDenied(err):
+		// The token isn't allowed to inspect mounts, keep the historical default
+		attrs := append([]any{
+			slog.String("mount_path", key.mount),
+			slog.Any("error", err),
+		}, observability.TraceAttrs(ctx)...)
+		observability.GetLogger().WarnContext(ctx, "Not allowed to detect KV version, assuming KV v2 (set vault.kv_version to silence)", attrs...)
+		version = 2
+	case err != nil:
+		return 0, fmt.Errorf("failed to detect KV version of mount %s: %w", key.mount, err)
+	}
+
+	c.kvVersions[key] = version
+	return version, nil
+}
+
+// detectKVVersion asks Vault for the version of a KV mount
+func (c *Client) detectKVVersion(ctx context.Context, mount string) (int, error) {
+	var secret *api.Secret
+	err := c.withReauth(ctx, func() (err error) {
+		secret, err = c.logical(ctx).ReadWithContext(ctx, "sys/internal/ui/mounts/"+mount)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if secret == nil || secret.Data == nil {
+		return 0, fmt.Errorf("no mount info returned for %s", mount)
+	}
+
+	if mountType, _ := secret.Data["type"].(string); mountType != "kv" && mountType != "generic" {
+		return 0, fmt.Errorf("mount %s is not a kv mount (type %q)", mount, mountType)
+	}
+
+	// KV v1 mounts either have no version option or version "1"
+	options, _ := secret.Data["options"].(map[string]interface{})
+	if version, _ := options["version"].(string); version == "2" {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+// ResolvePath returns the API path a token at path is written to, e.g. "secret/data/linode/tokens/x"
+// It detects the KV version of the mount if needed, so it can be used to check
+// the configuration before the first rotation.
+func (c *Client) ResolvePath(ctx context.Context, path string) (string, error) {
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.dataPath(ctx, version, path), nil
+}
+
+// dataPath returns the API path of a secret's data
+func (c *Client) dataPath(ctx context.Context, version int, path string) string {
+	if version == 1 {
+		return fmt.Sprintf("%s/%s", c.mount(ctx), path)
+	}
+	return fmt.Sprintf("%s/data/%s", c.mount(ctx), path)
+}
+
+// statePath returns the API path holding a token's state
+func (c *Client) statePath(ctx context.Context, version int, path string) string {
+	if version == 1 {
+		return fmt.Sprintf("%s/%s%s", c.mount(ctx), path, stateSuffix)
+	}
+	return fmt.Sprintf("%s/metadata/%s", c.mount(ctx), path)
+}
+
+// wrapData wraps secret data in the request body for the KV version
+func wrapData(version int, data map[string]interface{}) map[string]interface{} {
+	if version == 1 {
+		return data
+	}
+	return map[string]interface{}{
+		"data": data,
+	}
+}
+
+// unwrapData extracts secret data from a KV read response
+func unwrapData(version int, secret *api.Secret) (map[string]interface{}, bool) {
+	if version == 1 {
+		return secret.Data, true
+	}
+	// A deleted version is returned with its metadata and null data
+	if secret.Data["data"] == nil {
+		return nil, true
+	}
+	data, ok := secret.Data["data"].(map[string]interface{})
+	return data, ok
+}
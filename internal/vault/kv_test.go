@@ -0,0 +1,411 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wbh1/latr/pkg/models"
+)
+
+// newKVServer returns an in-memory Vault server with a single "secret" mount of the given version
+func newKVServer(t *testing.T, version string) (*httptest.Server, map[string]map[string]interface{}, *int) {
+	t.Helper()
+
+	var mu sync.Mutex
+	store := make(map[string]map[string]interface{})
+	mountLookups := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "test-token"},
+			})
+		case r.URL.Path == "/v1/sys/internal/ui/mounts/secret":
+			mountLookups++
+			options := map[string]interface{}{}
+			if version != "" {
+				options["version"] = version
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"type": "kv", "path": "secret/", "options": options},
+			})
+		case r.Method == http.MethodDelete:
+			// Deleting KV v2 metadata removes every version of the data
+			delete(store, r.URL.Path)
+			delete(store, strings.Replace(r.URL.Path, "/metadata/", "/data/", 1))
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPut || r.Method == http.MethodPost:
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			store[r.URL.Path] = body
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet:
+			data, ok := store[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if version == "2" {
+				data = map[string]interface{}{"data": data["data"], "custom_metadata": data["custom_metadata"]}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, store, &mountLookups
+}
+
+func TestKVv1_TokenAndState(t *testing.T) {
+	server, store, mountLookups := newKVServer(t, "1")
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, client.WriteToken(ctx, "linode/tokens/test", "my-token"))
+
+	state := &models.TokenState{
+		Label:             "test",
+		CurrentLinodeID:   42,
+		DeliveredLinodeID: 41,
+		Backends:          map[string]int{"vault:linode/tokens/test": 42, "file:/etc/token": 41},
+		LastRotatedAt:     time.Now().Truncate(time.Second),
+		RotationCount:     3,
+	}
+	require.NoError(t, client.WriteTokenState(ctx, "linode/tokens/test", state))
+
+	// The token is written directly and the state goes into a sibling key
+	assert.Equal(t, "my-token", store["/v1/secret/linode/tokens/test"]["token"])
+	assert.Equal(t, "42", store["/v1/secret/linode/tokens/test.latr-state"]["current_linode_id"])
+
+	token, err := client.ReadToken(ctx, "linode/tokens/test")
+	require.NoError(t, err)
+	assert.Equal(t, "my-token", token)
+
+	readState, err := client.ReadTokenState(ctx, "linode/tokens/test")
+	require.NoError(t, err)
+	require.NotNil(t, readState)
+	assert.Equal(t, 42, readState.CurrentLinodeID)
+	assert.Equal(t, 41, readState.DeliveredLinodeID)
+	assert.Equal(t, state.Backends, readState.Backends)
+	assert.Equal(t, 3, readState.RotationCount)
+	assert.True(t, state.LastRotatedAt.Equal(readState.LastRotatedAt))
+
+	// The mount is only inspected once
+	assert.Equal(t, 1, *mountLookups)
+}
+
+func TestKVv2_Detected(t *testing.T) {
+	server, store, _ := newKVServer(t, "2")
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, client.WriteToken(ctx, "linode/tokens/test", "my-token"))
+	require.NoError(t, client.WriteTokenState(ctx, "linode/tokens/test", &models.TokenState{Label: "test"}))
+
+	assert.Contains(t, store, "/v1/secret/data/linode/tokens/test")
+	assert.Contains(t, store, "/v1/secret/metadata/linode/tokens/test")
+}
+
+func TestPendingToken(t *testing.T) {
+	for _, version := range []string{"1", "2"} {
+		t.Run("kv"+version, func(t *testing.T) {
+			server, store, _ := newKVServer(t, version)
+
+			client, err := NewClient(&Config{
+				Address:   server.URL,
+				RoleID:    "test-role-id",
+				SecretID:  "test-secret-id",
+				MountPath: "secret",
+			})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+
+			pending, err := client.ReadPendingToken(ctx, "linode/tokens/test")
+			require.NoError(t, err)
+			assert.Nil(t, pending)
+
+			expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+			require.NoError(t, client.WritePendingToken(ctx, "linode/tokens/test", &models.Token{
+				ID:        42,
+				Token:     "pending-token",
+				ExpiresAt: expiresAt,
+			}))
+
+			pending, err = client.ReadPendingToken(ctx, "linode/tokens/test")
+			require.NoError(t, err)
+			require.NotNil(t, pending)
+			assert.Equal(t, 42, pending.ID)
+			assert.Equal(t, "pending-token", pending.Token)
+			assert.True(t, expiresAt.Equal(pending.ExpiresAt))
+
+			require.NoError(t, client.DeletePendingToken(ctx, "linode/tokens/test"))
+			assert.Empty(t, store)
+
+			pending, err = client.ReadPendingToken(ctx, "linode/tokens/test")
+			require.NoError(t, err)
+			assert.Nil(t, pending)
+		})
+	}
+}
+
+func TestKVVersion_Explicit(t *testing.T) {
+	// The server reports KV v2, but the explicit setting wins without a lookup
+	server, store, mountLookups := newKVServer(t, "2")
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		KVVersion: 1,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.WriteToken(context.Background(), "linode/tokens/test", "my-token"))
+	assert.Contains(t, store, "/v1/secret/linode/tokens/test")
+	assert.Equal(t, 0, *mountLookups)
+}
+
+// newMountLookupServer returns a Vault server whose mount lookups answer with the given
+// statuses in turn, reporting a KV v1 mount once they run out
+func newMountLookupServer(t *testing.T, statuses ...int) (*httptest.Server, map[string]bool) {
+	t.Helper()
+
+	var mu sync.Mutex
+	written := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "test-token"},
+			})
+		case r.URL.Path == "/v1/sys/internal/ui/mounts/secret":
+			if len(statuses) > 0 {
+				w.WriteHeader(statuses[0])
+				statuses = statuses[1:]
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"type": "kv", "path": "secret/", "options": map[string]interface{}{}},
+			})
+		default:
+			written[r.URL.Path] = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, written
+}
+
+func TestKVVersion_PermissionDeniedAssumesV2(t *testing.T) {
+	// Denied twice, since the client logs in again after a 403 and retries once
+	server, written := newMountLookupServer(t, http.StatusForbidden, http.StatusForbidden)
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.WriteToken(context.Background(), "linode/tokens/test", "my-token"))
+	assert.True(t, written["/v1/secret/data/linode/tokens/test"])
+}
+
+func TestKVVersion_DetectsAgainAfterError(t *testing.T) {
+	server, written := newMountLookupServer(t, http.StatusBadRequest)
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+	})
+	require.NoError(t, err)
+
+	// A transient failure isn't mistaken for KV v2, and isn't remembered
+	ctx := context.Background()
+	err = client.WriteToken(ctx, "linode/tokens/test", "my-token")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to detect KV version of mount secret")
+	assert.Empty(t, written)
+
+	require.NoError(t, client.WriteToken(ctx, "linode/tokens/test", "my-token"))
+	assert.True(t, written["/v1/secret/linode/tokens/test"])
+}
+
+func TestReadToken_DeletedVersion(t *testing.T) {
+	// KV v2 answers a read of a deleted version with its metadata and null data
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/approle/login" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "test-token"},
+			})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     nil,
+				"metadata": map[string]interface{}{"deletion_time": "2024-01-01T00:00:00Z", "version": 3},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		KVVersion: 2,
+	})
+	require.NoError(t, err)
+
+	_, err = client.ReadToken(context.Background(), "linode/tokens/test")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestWithMount(t *testing.T) {
+	server, store, mountLookups := newKVServer(t, "1")
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "kv",
+	})
+	require.NoError(t, err)
+
+	ctx := WithMount(context.Background(), "/secret/")
+	require.NoError(t, client.WriteToken(ctx, "linode/tokens/test", "my-token"))
+	assert.Contains(t, store, "/v1/secret/linode/tokens/test")
+
+	path, err := client.ResolvePath(ctx, "linode/tokens/test")
+	require.NoError(t, err)
+	assert.Equal(t, "secret/linode/tokens/test", path)
+	assert.Equal(t, 1, *mountLookups)
+}
+
+func TestWriteTokenCAS(t *testing.T) {
+	var writes []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "test-token"},
+			})
+		case "/v1/secret/metadata/test/path":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"current_version": 3},
+			})
+		case "/v1/secret/data/test/path":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			writes = append(writes, body)
+
+			options, _ := body["options"].(map[string]interface{})
+			if options["cas"] != float64(3) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		KVVersion: 2,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	// The version is reported even though latr hasn't stored any state yet
+	state, err := client.ReadTokenState(ctx, "test/path")
+	require.NoError(t, err)
+	require.NotNil(t, state)
+	assert.Equal(t, 3, state.Version)
+
+	require.NoError(t, client.WriteTokenCAS(ctx, "test/path", "my-token", 42, state.Version))
+
+	// The Linode ID goes into the same write as the token
+	data, _ := writes[0]["data"].(map[string]interface{})
+	assert.Equal(t, "my-token", data["token"])
+	assert.Equal(t, "42", data["linode_id"])
+
+	err = client.WriteTokenCAS(ctx, "test/path", "my-token", 42, 2)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.Len(t, writes, 2)
+}
+
+func TestReadTokenLinodeID(t *testing.T) {
+	server, store, _ := newKVServer(t, "2")
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, client.WriteTokenCAS(ctx, "linode/tokens/test", "my-token", 42, 0))
+
+	id, err := client.ReadTokenLinodeID(ctx, "linode/tokens/test")
+	require.NoError(t, err)
+	assert.Equal(t, 42, id)
+
+	// A token written without its ID, e.g. by hand
+	store["/v1/secret/data/linode/tokens/test"] = map[string]interface{}{"data": map[string]interface{}{"token": "manual"}}
+	id, err = client.ReadTokenLinodeID(ctx, "linode/tokens/test")
+	require.NoError(t, err)
+	assert.Zero(t, id)
+
+	_, err = client.ReadTokenLinodeID(ctx, "linode/tokens/missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,135 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// ErrLockUnsupported is returned by lock operations on mounts without check-and-set support
+var ErrLockUnsupported = errors.New("locks require a KV v2 mount")
+
+// lockRecord is the content of a lock secret
+type lockRecord struct {
+	holder    string
+	expiresAt time.Time
+}
+
+// TryAcquireLock takes the lock at path for holder until ttl from now, or extends it
+// if holder already owns it
+// It returns false if another holder's lease hasn't expired yet, or if another
+// replica won the race for it. Races are settled with check-and-set, so the lock
+// requires a KV v2 mount.
+func (c *Client) TryAcquireLock(ctx context.Context, path, holder string, ttl time.Duration) (bool, error) {
+	current, version, err := c.readLock(ctx, path)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	now := time.Now()
+	if current.holder != "" && current.holder != holder && now.Before(current.expiresAt) {
+		return false, nil
+	}
+
+	err = c.writeLock(ctx, path, lockRecord{holder: holder, expiresAt: now.Add(ttl)}, version)
+	if errors.Is(err, ErrVersionConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	return true, nil
+}
+
+// ReleaseLock expires the lock at path if holder owns it, so a standby can take over right away
+func (c *Client) ReleaseLock(ctx context.Context, path, holder string) error {
+	current, version, err := c.readLock(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	if current.holder != holder {
+		return nil
+	}
+
+	err = c.writeLock(ctx, path, lockRecord{expiresAt: time.Now()}, version)
+	// Someone else took the lock over in the meantime
+	if errors.Is(err, ErrVersionConflict) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	return nil
+}
+
+// readLock reads the lock at path along with the secret version it was read at
+// A missing lock is returned as an empty record at version 0.
+func (c *Client) readLock(ctx context.Context, path string) (lockRecord, int, error) {
+	kvVersion, err := c.kvVersion(ctx)
+	if err != nil {
+		return lockRecord{}, 0, err
+	}
+	if kvVersion == 1 {
+		return lockRecord{}, 0, ErrLockUnsupported
+	}
+
+	var secret *api.Secret
+	err = c.withReauth(ctx, func() (err error) {
+		secret, err = c.logical(ctx).ReadWithContext(ctx, c.dataPath(ctx, kvVersion, path))
+		return err
+	})
+	if err != nil {
+		return lockRecord{}, 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return lockRecord{}, 0, nil
+	}
+
+	// Deleted versions still report their metadata, which is needed for check-and-set
+	version := 0
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok {
+		if v, ok := metadata["version"].(json.Number); ok {
+			if n, err := v.Int64(); err == nil {
+				version = int(n)
+			}
+		}
+	}
+
+	var record lockRecord
+	if data, ok := unwrapData(kvVersion, secret); ok {
+		record.holder, _ = data["holder"].(string)
+		if expiresAt, ok := data["expires_at"].(string); ok {
+			record.expiresAt, _ = time.Parse(time.RFC3339Nano, expiresAt)
+		}
+	}
+
+	return record, version, nil
+}
+
+// writeLock writes record to the lock at path if the secret is still at version
+func (c *Client) writeLock(ctx context.Context, path string, record lockRecord, version int) error {
+	data := map[string]interface{}{
+		"data": map[string]interface{}{
+			"holder":     record.holder,
+			"expires_at": record.expiresAt.UTC().Format(time.RFC3339Nano),
+		},
+		"options": map[string]interface{}{
+			"cas": version,
+		},
+	}
+
+	err := c.withReauth(ctx, func() error {
+		_, err := c.logical(ctx).WriteWithContext(ctx, c.dataPath(ctx, 2, path), data)
+		return err
+	})
+	if isCASMismatch(err) {
+		return ErrVersionConflict
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLockServer returns a Vault server with a single KV v2 secret that enforces check-and-set
+func newLockServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	var data map[string]interface{}
+	version := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "test-token"},
+			})
+		case r.URL.Path == "/v1/sys/internal/ui/mounts/secret":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"type": "kv", "path": "secret/", "options": map[string]interface{}{"version": "2"}},
+			})
+		case r.URL.Path != "/v1/secret/data/latr/leader":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			if version == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     data,
+					"metadata": map[string]interface{}{"version": version},
+				},
+			})
+		default:
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			options, _ := body["options"].(map[string]interface{})
+			if options["cas"] != float64(version) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+				return
+			}
+			data, _ = body["data"].(map[string]interface{})
+			version++
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestLock(t *testing.T) {
+	server := newLockServer(t)
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		KVVersion: 2,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	acquired, err := client.TryAcquireLock(ctx, "latr/leader", "replica-a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// The holder can renew, others have to wait for the lease to lapse
+	acquired, err = client.TryAcquireLock(ctx, "latr/leader", "replica-a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = client.TryAcquireLock(ctx, "latr/leader", "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	// Releasing by a non-holder is a no-op
+	require.NoError(t, client.ReleaseLock(ctx, "latr/leader", "replica-b"))
+	acquired, err = client.TryAcquireLock(ctx, "latr/leader", "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, client.ReleaseLock(ctx, "latr/leader", "replica-a"))
+	acquired, err = client.TryAcquireLock(ctx, "latr/leader", "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestLock_ExpiredLeaseIsTakenOver(t *testing.T) {
+	server := newLockServer(t)
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+		KVVersion: 2,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	acquired, err := client.TryAcquireLock(ctx, "latr/leader", "replica-a", time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	time.Sleep(5 * time.Millisecond)
+
+	acquired, err = client.TryAcquireLock(ctx, "latr/leader", "replica-b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestLock_RequiresKVv2(t *testing.T) {
+	server, _, _ := newKVServer(t, "1")
+
+	client, err := NewClient(&Config{
+		Address:   server.URL,
+		RoleID:    "test-role-id",
+		SecretID:  "test-secret-id",
+		MountPath: "secret",
+	})
+	require.NoError(t, err)
+
+	_, err = client.TryAcquireLock(context.Background(), "latr/leader", "replica-a", time.Minute)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrLockUnsupported)
+}
@@ -0,0 +1,106 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/wbh1/latr/pkg/models"
+)
+
+// pendingSuffix is appended to a token's path to form the secret holding a token
+// that was created but not yet delivered to every storage backend
+const pendingSuffix = ".latr-pending"
+
+// WritePendingToken keeps token until it has been delivered to every storage backend
+// It's stored as secret data next to the token rather than in state metadata, so
+// that the value is protected like any other secret.
+func (c *Client) WritePendingToken(ctx context.Context, path string, token *models.Token) error {
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to write pending token to vault: %w", err)
+	}
+
+	data := wrapData(version, map[string]interface{}{
+		"token":      token.Token,
+		"linode_id":  strconv.Itoa(token.ID),
+		"expires_at": token.ExpiresAt.Format(time.RFC3339),
+	})
+
+	err = c.withReauth(ctx, func() error {
+		_, err := c.logical(ctx).WriteWithContext(ctx, c.dataPath(ctx, version, path+pendingSuffix), data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write pending token to vault: %w", err)
+	}
+
+	return nil
+}
+
+// ReadPendingToken reads the token kept by WritePendingToken
+// nil is returned when no token is pending.
+func (c *Client) ReadPendingToken(ctx context.Context, path string) (*models.Token, error) {
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending token from vault: %w", err)
+	}
+
+	var secret *api.Secret
+	err = c.withReauth(ctx, func() (err error) {
+		secret, err = c.logical(ctx).ReadWithContext(ctx, c.dataPath(ctx, version, path+pendingSuffix))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending token from vault: %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	data, ok := unwrapData(version, secret)
+	if !ok || data == nil {
+		return nil, nil
+	}
+
+	token := &models.Token{}
+	token.Token, _ = data["token"].(string)
+	if id, ok := data["linode_id"].(string); ok {
+		token.ID, _ = strconv.Atoi(id)
+	}
+	if expiresAt, ok := data["expires_at"].(string); ok {
+		token.ExpiresAt, _ = time.Parse(time.RFC3339, expiresAt)
+	}
+	if token.Token == "" {
+		return nil, nil
+	}
+
+	return token, nil
+}
+
+// DeletePendingToken removes the pending token
+// On KV v2 every version is destroyed, so the value doesn't linger in the secret's history.
+func (c *Client) DeletePendingToken(ctx context.Context, path string) error {
+	version, err := c.kvVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete pending token from vault: %w", err)
+	}
+
+	// Deleting a KV v2 secret's metadata deletes all of its versions
+	deletePath := c.dataPath(ctx, version, path+pendingSuffix)
+	if version != 1 {
+		deletePath = c.statePath(ctx, version, path+pendingSuffix)
+	}
+
+	err = c.withReauth(ctx, func() error {
+		_, err := c.logical(ctx).DeleteWithContext(ctx, deletePath)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete pending token from vault: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeClientCert generates a self-signed client certificate and returns the cert and key paths
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "latr"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, "client.pem")
+	keyPath := filepath.Join(dir, "client-key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return cert, certPath, keyPath
+}
+
+func TestNewClient_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, certPath, keyPath := writeClientCert(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/approle/login" {
+			response := map[string]interface{}{
+				"auth": map[string]interface{}{
+					"client_token": "test-token",
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caPath := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caPath, caPEM, 0600))
+
+	config := &Config{
+		Address:       server.URL,
+		RoleID:        "test-role-id",
+		SecretID:      "test-secret-id",
+		MountPath:     "secret",
+		CACert:        caPath,
+		ClientCert:    certPath,
+		ClientKey:     keyPath,
+		TLSServerName: "example.com", // httptest certificates are issued for example.com
+	}
+
+	client, err := NewClient(config)
+	require.NoError(t, err)
+	assert.NotNil(t, client)
+
+	// Without the client certificate the handshake is rejected
+	config.ClientCert = ""
+	config.ClientKey = ""
+	_, err = NewClient(config)
+	require.Error(t, err)
+
+	// Without the CA the server certificate can't be verified
+	config.CACert = ""
+	config.ClientCert = certPath
+	config.ClientKey = keyPath
+	_, err = NewClient(config)
+	require.Error(t, err)
+}
+
+func TestNewClient_InvalidCACert(t *testing.T) {
+	config := &Config{
+		Address:   "https://127.0.0.1:8200",
+		MountPath: "secret",
+		CACert:    filepath.Join(t.TempDir(), "missing.pem"),
+	}
+
+	client, err := NewClient(config)
+	require.Error(t, err)
+	assert.Nil(t, client)
+	assert.Contains(t, err.Error(), "failed to configure vault tls")
+}
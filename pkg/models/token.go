@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"time"
 )
 
@@ -10,7 +11,8 @@ type Token struct {
 	Label     string    // Token label/name
 	Token     string    // The actual token value (secret)
 	CreatedAt time.Time // When the token was created
-	ExpiresAt time.Time // When the token expires
+	ExpiresAt time.Time // When the token expires, zero if it never does
+	NeverExpires bool   // The token was created without an expiry
 	Scopes    string    // Token scopes
 	Team      string    // Owning team (metadata)
 	Validity  time.Duration // How long the token is valid for
@@ -21,16 +23,24 @@ type Token struct {
 type TokenState struct {
 	Label              string    // Token label (matches config)
 	CurrentLinodeID    int       // Current active token ID in Linode
-	CurrentTokenValue  string    // Current token value
+	CurrentTokenValue  string    // Current token value, never persisted with the state
+	DeliveredLinodeID  int       // Token ID last delivered to every storage backend
+	Backends           map[string]int // Token ID held by each storage backend, keyed by its description
 	LastRotatedAt      time.Time // When the token was last rotated
 	PreviousLinodeID   int       // Previous token ID (not yet deleted)
 	PreviousExpiresAt  time.Time // When the previous token expires
 	RotationCount      int       // How many times the token has been rotated
+	Version            int       // KV version of the secret when the state was read, used for check-and-set writes
 }
 
 // NeedsRotation determines if a token needs to be rotated based on the threshold percentage
 // thresholdPercent is the percentage of validity remaining at which rotation should occur
+// Tokens that never expire don't age, so they are handled by policy instead.
 func (t *Token) NeedsRotation(thresholdPercent int) bool {
+	if t.NeverExpires {
+		return false
+	}
+
 	// If already expired, definitely needs rotation
 	if t.IsExpired() {
 		return true
@@ -42,16 +52,23 @@ func (t *Token) NeedsRotation(thresholdPercent int) bool {
 
 // IsExpired returns true if the token has already expired
 func (t *Token) IsExpired() bool {
-	return time.Now().After(t.ExpiresAt)
+	return !t.NeverExpires && time.Now().After(t.ExpiresAt)
 }
 
-// TimeUntilExpiry returns the duration until the token expires
+// TimeUntilExpiry returns the duration until the token expires, or the longest
+// duration for a token that never expires
 func (t *Token) TimeUntilExpiry() time.Duration {
+	if t.NeverExpires {
+		return math.MaxInt64
+	}
 	return time.Until(t.ExpiresAt)
 }
 
 // PercentValidityRemaining calculates what percentage of the token's validity period remains
 func (t *Token) PercentValidityRemaining() float64 {
+	if t.NeverExpires {
+		return 100.0
+	}
 	if t.IsExpired() {
 		return 0.0
 	}
@@ -241,3 +241,17 @@ func TestTokenStateAfterRotation(t *testing.T) {
 	assert.Equal(t, 1, newState.RotationCount)
 	require.NotNil(t, newState.LastRotatedAt)
 }
+
+func TestTokenNeverExpires(t *testing.T) {
+	token := &Token{
+		Label:        "manual-token",
+		CreatedAt:    time.Now().Add(-365 * 24 * time.Hour),
+		NeverExpires: true,
+		Validity:     90 * 24 * time.Hour,
+	}
+
+	assert.False(t, token.IsExpired())
+	assert.False(t, token.NeedsRotation(100))
+	assert.Equal(t, 100.0, token.PercentValidityRemaining())
+	assert.Greater(t, token.TimeUntilExpiry(), 100*365*24*time.Hour)
+}